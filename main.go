@@ -6,8 +6,6 @@ import (
 	"log"
 	"math"
 	"os"
-	"path/filepath"
-	"strings"
 	"wav/parser"
 	"wav/renderer"
 	"wav/utils"
@@ -17,6 +15,11 @@ var wav *parser.Wav
 
 var options utils.Options
 
+// peakBuckets bounds the number of buckets the samples are reduced to while
+// they're read, which is plenty for any of the outputs; longer files get
+// bigger buckets rather than more of them.
+const peakBuckets = 1 << 18
+
 func init() {
 	options.Width = flag.Int("width", 0, "output width")
 	options.Height = flag.Int("height", 0, "output height")
@@ -26,6 +29,17 @@ func init() {
 	options.Border = flag.Bool("border", false, "whether the ascii representation should have a border")
 	options.Resolution = flag.Int("resolution", 0, "data points per second")
 	options.Format = flag.Int("format", 0, "output format")
+	options.TimeAxis = flag.String("time-axis", "", "label the waveform's time positions: elapsed, clock (time of day) or smpte")
+	options.FPS = flag.Int("fps", 25, "frames per second for the smpte time axis")
+	options.Loops = flag.Bool("loops", false, "whether to highlight the sampler loops")
+	options.PeaksOnly = flag.Bool("peaks", false, "estimate the levels of MP3 files instead of fully decoding them, which is faster")
+	options.Info = flag.Bool("info", false, "only print the properties of the given files, without decoding their samples")
+	options.Raw = flag.String("raw", "", "read headerless PCM in the given format, as <encoding>:<rate>:<channels> (e.g. s16le:44100:2)")
+	options.Lenient = flag.Bool("lenient", false, "salvage what can be read of damaged files instead of failing")
+	options.Start = flag.Duration("start", 0, "only decode and draw the samples from this time on (e.g. 1m30s)")
+	options.End = flag.Duration("end", 0, "only decode and draw the samples up to this time (e.g. 2m)")
+	options.Channel = flag.String("channel", "", "draw a single channel, given by its number, its speaker position (e.g. FL or LFE) or its track name, instead of mixing them all down")
+	options.Cover = flag.Bool("cover", false, "show the cover art embedded in the file in the middle of the radial svg")
 
 	flag.Usage = options.Usage(flag.CommandLine)
 }
@@ -34,25 +48,50 @@ func main() {
 	flag.Parse()
 
 	filename := flag.Arg(0)
-	ext := strings.ToLower(filepath.Ext(filename))
-	if len(filename) < 1 || ext != ".wav" {
-		log.Fatal("no .wav file provided")
+	if len(filename) < 1 {
+		log.Fatal("no file provided; use - to read from stdin")
+	}
+
+	if *options.Info {
+		// only the headers are read, so that many files can be listed quickly
+		failed := false
+		for _, filename := range flag.Args() {
+			if err := printHeaderInfo(filename, &options); err != nil {
+				log.Printf("%s: %v", filename, err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
 	}
 
-	f, err := os.Open(filename)
+	f, err := openFile(filename)
+	if err != nil {
+		log.Fatalf("failed opening the file: %v", err)
+	}
 	defer func(f *os.File) {
 		err := f.Close()
 		if err != nil {
 			log.Fatal("failed closing the file")
 		}
 	}(f)
-	if err != nil {
-		log.Fatalf("failed opening the file: %v", err)
-	}
 
-	if wav, err = parser.Parse(f); err != nil {
+	parserOptions := parser.Options{
+		PeaksOnly: *options.PeaksOnly,
+		Buckets:   peakBuckets,
+		Lenient:   *options.Lenient,
+		Start:     *options.Start,
+		End:       *options.End,
+		Channel:   *options.Channel,
+	}
+	if wav, err = parseFile(f, &options, parserOptions); err != nil {
 		log.Fatalf("error parsing the file: %v", err)
 	}
+	for _, problem := range wav.Problems {
+		log.Printf("warning: %v", problem)
+	}
 
 	if err := wav.CheckFormat(); err != nil {
 		log.Fatalf("validation error: %v", err)
@@ -96,6 +135,53 @@ func main() {
 
 }
 
+// openFile opens the named file, or stdin for "-".
+func openFile(filename string) (*os.File, error) {
+	if filename == "-" {
+		return os.Stdin, nil
+	}
+
+	return os.Open(filename)
+}
+
+func parseFile(f *os.File, options *utils.Options, parserOptions parser.Options) (*parser.Wav, error) {
+	if *options.Raw == "" {
+		return parser.ParseWithOptions(f, parserOptions)
+	}
+
+	format, err := parser.ParseRawFormat(*options.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return parser.ParseRawWithOptions(f, format, parserOptions)
+}
+
+func printHeaderInfo(filename string, options *utils.Options) error {
+	f, err := openFile(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	parserOptions := parser.Options{HeaderOnly: true, Lenient: *options.Lenient, Start: *options.Start, End: *options.End, Channel: *options.Channel}
+	wav, err := parseFile(f, options, parserOptions)
+	if err != nil {
+		return err
+	}
+	for _, problem := range wav.Problems {
+		log.Printf("%s: warning: %v", filename, problem)
+	}
+
+	if err := wav.CheckFormat(); err != nil {
+		return fmt.Errorf("validation error: %w", err)
+	}
+
+	fmt.Println(getInfo(wav, ""))
+
+	return nil
+}
+
 func getBlobSvg(wav *parser.Wav, options *utils.Options) (string, error) {
 	const (
 		defaultWidth      = 800
@@ -103,7 +189,7 @@ func getBlobSvg(wav *parser.Wav, options *utils.Options) (string, error) {
 		defaultResolution = 5
 	)
 
-	monoSamples := wav.GetMonoSamples()
+	peaks := wav.GetPeaks(peakBuckets)
 
 	width := *options.Width
 	if width == 0 {
@@ -122,9 +208,14 @@ func getBlobSvg(wav *parser.Wav, options *utils.Options) (string, error) {
 		resolution = defaultResolution
 	}
 
-	scaledSamples := utils.ScaleBetween(monoSamples, 0, int16(height-padding))
+	amplitudes := scaleAmplitudes(wav, peaks, float64(height-padding))
 
-	svg, err := renderer.ToBlobSvg(wav, scaledSamples, width, height, resolution)
+	overlay, err := getOverlay(options)
+	if err != nil {
+		return "", err
+	}
+
+	svg, err := renderer.ToBlobSvg(wav, amplitudes, int(peaks.BucketSize), width, height, resolution, overlay)
 
 	return svg, err
 }
@@ -136,7 +227,7 @@ func getSingleLineSvg(wav *parser.Wav, options *utils.Options) (string, error) {
 		defaultResolution = 10
 	)
 
-	monoSamples := wav.GetMonoSamples()
+	peaks := wav.GetPeaks(peakBuckets)
 
 	width := *options.Width
 	if width == 0 {
@@ -155,9 +246,14 @@ func getSingleLineSvg(wav *parser.Wav, options *utils.Options) (string, error) {
 		resolution = defaultResolution
 	}
 
-	scaledSamples := utils.ScaleBetween(monoSamples, 0, int16(height-padding))
+	amplitudes := scaleAmplitudes(wav, peaks, float64(height-padding))
+
+	overlay, err := getOverlay(options)
+	if err != nil {
+		return "", err
+	}
 
-	svg, err := renderer.ToSingleLineSvg(wav, scaledSamples, width, height, resolution)
+	svg, err := renderer.ToSingleLineSvg(wav, amplitudes, int(peaks.BucketSize), width, height, resolution, overlay)
 
 	return svg, err
 }
@@ -170,7 +266,7 @@ func getRadialSvg(wav *parser.Wav, options *utils.Options) (string, error) {
 		defaultResolution   = 20
 	)
 
-	monoSamples := wav.GetMonoSamples()
+	peaks := wav.GetPeaks(peakBuckets)
 
 	width := *options.Width
 	if width == 0 {
@@ -195,9 +291,16 @@ func getRadialSvg(wav *parser.Wav, options *utils.Options) (string, error) {
 		circleRadius = defaultCircleRadius
 	}
 
-	scaledSamples := utils.ScaleBetween(monoSamples, 0, int16(math.Min(float64(width), float64(height))/2-float64(padding)-float64(circleRadius)))
+	amplitudes := scaleAmplitudes(wav, peaks, math.Min(float64(width), float64(height))/2-float64(padding)-float64(circleRadius))
+
+	var cover *parser.Picture
+	if *options.Cover {
+		if cover = wav.GetCoverArt(); cover == nil {
+			log.Printf("warning: no cover art found")
+		}
+	}
 
-	svg, err := renderer.ToRadialSvg(wav, scaledSamples, width, height, circleRadius, resolution)
+	svg, err := renderer.ToRadialSvg(wav, amplitudes, int(peaks.BucketSize), width, height, circleRadius, resolution, cover)
 
 	return svg, err
 }
@@ -207,7 +310,7 @@ func getAscii(wav *parser.Wav, options *utils.Options) (string, error) {
 		defaultWidth  = 80
 		defaultHeight = 15
 	)
-	monoSamples := wav.GetMonoSamples()
+	peaks := wav.GetPeaks(peakBuckets)
 
 	width := *options.Width
 	if width == 0 {
@@ -226,13 +329,54 @@ func getAscii(wav *parser.Wav, options *utils.Options) (string, error) {
 
 	border := *options.Border
 
-	scaledSamples := utils.ScaleBetween(monoSamples, 0, int16(height/2-padding))
+	amplitudes := scaleAmplitudes(wav, peaks, float64(height/2-padding))
 
-	output, err := renderer.ToAscii(scaledSamples, width, height, options.GetChars(), border)
+	overlay, err := getOverlay(options)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := renderer.ToAscii(wav, amplitudes, width, height, options.GetChars(), border, overlay)
 
 	return output, err
 }
 
+// scaleAmplitudes scales the magnitudes of the buckets so that the peak of
+// what's drawn reaches scaledMax. The peak stored in the PEAK chunk saves
+// looking for it when it's the peak of what's drawn, which is a single
+// channel, unless only a span of the file was decoded, or measuring the
+// samples while decoding them showed that it's wrong; the peak of a downmix
+// can be anywhere below the peaks of its channels.
+func scaleAmplitudes(wav *parser.Wav, peaks *parser.Peaks, scaledMax float64) []float64 {
+	magnitudes := peaks.Magnitudes()
+
+	if p := wav.PeakChunk; p != nil && wav.Span == nil {
+		ch := wav.SelectedChannel - 1
+		if wav.NumChannels == 1 {
+			ch = 0
+		}
+
+		if ch >= 0 && ch < len(p.Peaks) && p.Peaks[ch].Value > 0 && (ch >= len(p.Measured) || p.Peaks[ch].Matches(p.Measured[ch])) {
+			return utils.ScaleToPeak(magnitudes, float64(p.Peaks[ch].Value), 0, scaledMax)
+		}
+	}
+
+	return utils.ScaleBetween(magnitudes, 0, scaledMax)
+}
+
+func getOverlay(options *utils.Options) (renderer.Overlay, error) {
+	timeAxis, err := renderer.ParseTimeAxis(*options.TimeAxis)
+	if err != nil {
+		return renderer.Overlay{}, err
+	}
+
+	return renderer.Overlay{
+		TimeAxis: timeAxis,
+		FPS:      *options.FPS,
+		Loops:    *options.Loops,
+	}, nil
+}
+
 func getInfo(wav *parser.Wav, waveform string) string {
 	return renderer.ToInfo(wav, waveform)
 }
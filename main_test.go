@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"testing"
 	"wav/parser"
 	"wav/utils"
@@ -8,30 +9,49 @@ import (
 
 func TestToMonoSamples(t *testing.T) {
 	w := &parser.Wav{
-		Data: [][]int16{
-			{0, 0, 5, 5, 12345, 12345, -12345},
-			{0, 1, 7, 8, 16789, -12345, 0},
+		Data: [][]float32{
+			{0, 0, 0.5, 0.5, 0.25, 0.25, -0.75},
+			{0, 0.125, 0.75, 0.25, 0.75, -0.25, 0},
 		},
 	}
 
 	given := w.GetMonoSamples()
-	expected := []int16{0, 0, 6, 6, 14567, 0, -6172}
+	expected := []float32{0, 0.0625, 0.625, 0.375, 0.5, 0, -0.375}
 
 	var i int
 	for ; i < len(expected); i++ {
 		if expected[i] != given[i] {
-			t.Errorf("expected %d does not equal given %d", expected[i], given[i])
+			t.Errorf("expected %f does not equal given %f", expected[i], given[i])
 		}
 	}
 }
 
 func TestScaleBetween(t *testing.T) {
-	given := utils.ScaleBetween([]int16{-4, 0, 5, 6, 9}, 0, 100)
-	expected := []int16{44, 0, 55, 66, 100}
+	given := utils.ScaleBetween([]float32{-4, 0, 5, 6, 9}, 0, 100)
+	expected := []float64{400.0 / 9, 0, 500.0 / 9, 600.0 / 9, 100}
 
 	for i, _ := range expected {
-		if expected[i] != given[i] {
-			t.Errorf("expected %d does not equal given %d", expected[i], given[i])
+		if math.Abs(expected[i]-given[i]) > 1e-9 {
+			t.Errorf("expected %f does not equal given %f", expected[i], given[i])
 		}
 	}
 }
+
+func TestScaleAmplitudes(t *testing.T) {
+	w := &parser.Wav{
+		NumChannels: 2,
+		Data:        [][]float32{{1, -1}, {0, 0.25}},
+		PeakChunk:   &parser.PeakChunk{Peaks: []parser.PositionPeak{{Value: 1}, {Value: 0.5}}},
+	}
+
+	// the downmix peaks at 0.5, below the peak of the left channel
+	if given := scaleAmplitudes(w, w.GetPeaks(2), 100); given[0] != 100 {
+		t.Errorf("expected the downmix to be scaled to its own peak, given %v", given)
+	}
+
+	// the right channel is scaled to its entry of the PEAK chunk
+	w.SelectedChannel = 2
+	if given := scaleAmplitudes(w, w.GetPeaks(2), 100); given[1] != 50 {
+		t.Errorf("expected the right channel to be scaled to its stored peak, given %v", given)
+	}
+}
@@ -0,0 +1,325 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+var imaIndexTable = [16]int{-1, -1, -1, -1, 2, 4, 6, 8, -1, -1, -1, -1, 2, 4, 6, 8}
+
+var imaStepTable = [89]int{
+	7, 8, 9, 10, 11, 12, 13, 14, 16, 17, 19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+	50, 55, 60, 66, 73, 80, 88, 97, 107, 118, 130, 143, 157, 173, 190, 209, 230,
+	253, 279, 307, 337, 371, 408, 449, 494, 544, 598, 658, 724, 796, 876, 963,
+	1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066, 2272, 2499, 2749, 3024, 3327,
+	3660, 4026, 4428, 4871, 5358, 5894, 6484, 7132, 7845, 8630, 9493, 10442,
+	11487, 12635, 13899, 15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794,
+	32767,
+}
+
+var msAdaptationTable = [16]int{230, 230, 230, 230, 307, 409, 512, 614, 768, 614, 512, 409, 307, 230, 230, 230}
+
+// msDefaultCoefficients are the predictor coefficients every MS ADPCM file
+// starts its fmt chunk table with; they are used if the table is missing.
+var msDefaultCoefficients = [][2]int16{{256, 0}, {512, -256}, {0, 0}, {192, 64}, {240, 0}, {460, -208}, {392, -232}}
+
+func (w *Wav) isADPCM() bool {
+	code := w.GetFormatCode()
+
+	return code == FormatIMAADPCM || code == FormatMSADPCM
+}
+
+// getADPCMSamplesInBlock returns the number of samples per channel that a
+// block of the given length decodes to.
+func (w *Wav) getADPCMSamplesInBlock(length int64) int64 {
+	channels := int64(w.NumChannels)
+	if channels <= 0 {
+		return 0
+	}
+
+	if w.GetFormatCode() == FormatIMAADPCM {
+		// a 4-byte header per channel, holding the first sample, followed by
+		// groups of 4 bytes (8 samples) per channel
+		if length < 4*channels {
+			return 0
+		}
+
+		return 1 + (length-4*channels)/(4*channels)*8
+	}
+
+	// a 7-byte header per channel, holding the first two samples, followed by
+	// two samples per byte
+	if length < 7*channels {
+		return 0
+	}
+
+	return 2 + (length-7*channels)*2/channels
+}
+
+// checkSamplesPerBlock checks the number of samples per block that the fmt
+// chunk gives against the one its block size makes for, which is what the
+// blocks are decoded to; with Options.Lenient, a mismatch is only listed in
+// Problems.
+func (w *Wav) checkSamplesPerBlock(options Options) error {
+	if !w.isADPCM() || w.SamplesPerBlock == 0 {
+		return nil
+	}
+
+	expected := w.getADPCMSamplesInBlock(int64(w.BlockAlign))
+	if int64(w.SamplesPerBlock) == expected {
+		return nil
+	}
+
+	return w.salvage(fmt.Errorf("the fmt chunk gives %d samples per ADPCM block instead of the %d of %d-byte blocks", w.SamplesPerBlock, expected, w.BlockAlign), options)
+}
+
+// getADPCMNumSamples computes the number of samples per channel from the data
+// size when there's no fact chunk to read it from.
+func (w *Wav) getADPCMNumSamples() int64 {
+	blockAlign := int64(w.BlockAlign)
+	if blockAlign <= 0 {
+		return 0
+	}
+
+	fullBlocks := w.Subchunk2Size / blockAlign
+	numSamples := fullBlocks * w.getADPCMSamplesInBlock(blockAlign)
+	if rest := w.Subchunk2Size % blockAlign; rest > 0 {
+		numSamples += w.getADPCMSamplesInBlock(rest)
+	}
+
+	return numSamples
+}
+
+func parseADPCMData(cr *chunkReader, wav *Wav) error {
+	if wav.BlockAlign <= 0 || wav.NumChannels <= 0 {
+		return fmt.Errorf("invalid ADPCM block align %d for %d channels", wav.BlockAlign, wav.NumChannels)
+	}
+
+	streamed := wav.Subchunk2Size == unknownSize
+	remaining := wav.Subchunk2Size
+	block := make([]byte, wav.BlockAlign)
+
+	var read, decoded int64
+	if wav.Span != nil {
+		// every block decodes on its own to the same number of samples, so
+		// the ones before the span are seeked over
+		blocks := int64(0)
+		if perBlock := wav.getADPCMSamplesInBlock(int64(wav.BlockAlign)); perBlock > 0 {
+			blocks = wav.Span.Start / perBlock
+			decoded = blocks * perBlock
+		}
+		if !streamed && blocks*int64(wav.BlockAlign) > remaining {
+			blocks = remaining / int64(wav.BlockAlign)
+		}
+
+		skipped, err := skipFrames(cr, blocks, int64(wav.BlockAlign))
+		read = skipped * int64(wav.BlockAlign)
+		remaining -= read
+		if skipped < blocks {
+			decoded = skipped * wav.getADPCMSamplesInBlock(int64(wav.BlockAlign))
+		}
+		wav.position = decoded
+		if err != nil && !streamed {
+			wav.Subchunk2Size = read
+			if wav.SampleLength > decoded {
+				wav.SampleLength = decoded
+			}
+			return fmt.Errorf("error reading ADPCM block: %w", truncated(err))
+		}
+	}
+
+	for streamed || remaining > 0 {
+		if wav.spanDone() {
+			// the blocks after the span are only counted
+			if !streamed {
+				if err := cr.skip(remaining); err != nil {
+					return fmt.Errorf("error reading ADPCM block: %w", truncated(err))
+				}
+				break
+			}
+
+			n, err := cr.skipToEnd()
+			read += n
+			if err != nil {
+				return fmt.Errorf("error reading ADPCM block: %w", err)
+			}
+			break
+		}
+
+		length := int64(len(block))
+		if !streamed && remaining < length {
+			length = remaining
+		}
+
+		n, err := io.ReadFull(cr, block[:length])
+		read += int64(n)
+		if streamed && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			length = int64(n)
+		} else if err != nil {
+			// the size of what was read, for Options.Lenient
+			wav.Subchunk2Size = read - int64(n)
+			if wav.SampleLength > decoded {
+				wav.SampleLength = decoded
+			}
+			return fmt.Errorf("error reading ADPCM block: %w", truncated(err))
+		}
+
+		var samples [][]int16
+		if wav.GetFormatCode() == FormatIMAADPCM {
+			samples = decodeIMABlock(block[:length], int(wav.NumChannels))
+		} else {
+			samples = decodeMSBlock(block[:length], int(wav.NumChannels), wav.Coefficients)
+		}
+
+		normalized := make([][]float32, len(samples))
+		for c, channelSamples := range samples {
+			normalized[c] = make([]float32, len(channelSamples))
+			for i, sample := range channelSamples {
+				normalized[c][i] = float32(sample) / (1 << 15)
+			}
+		}
+
+		// the last block is usually padded, so whatever goes beyond the
+		// length stored in the fact chunk is trimmed
+		end := int64(-1)
+		if wav.SampleLength > 0 {
+			end = wav.SampleLength
+		}
+		wav.appendSamples(trimSamples(normalized, decoded, 0, end))
+		if len(normalized) > 0 {
+			decoded += int64(len(normalized[0]))
+		}
+
+		if err != nil {
+			break
+		}
+		remaining -= length
+	}
+
+	if streamed {
+		wav.Subchunk2Size = read
+	}
+
+	return nil
+}
+
+func decodeIMABlock(block []byte, channels int) [][]int16 {
+	samples := make([][]int16, channels)
+	if len(block) < 4*channels {
+		return samples
+	}
+
+	predictors := make([]int, channels)
+	indices := make([]int, channels)
+	for c := 0; c < channels; c++ {
+		header := block[4*c:]
+		predictors[c] = int(int16(binary.LittleEndian.Uint16(header)))
+		indices[c] = clamp(int(header[2]), 0, len(imaStepTable)-1)
+		samples[c] = append(samples[c], int16(predictors[c]))
+	}
+
+	data := block[4*channels:]
+	for len(data) >= 4*channels {
+		for c := 0; c < channels; c++ {
+			for _, b := range data[4*c : 4*c+4] {
+				// the low nibble comes first
+				for _, nibble := range [2]uint8{b & 0x0f, b >> 4} {
+					step := imaStepTable[indices[c]]
+
+					diff := step >> 3
+					if nibble&1 != 0 {
+						diff += step >> 2
+					}
+					if nibble&2 != 0 {
+						diff += step >> 1
+					}
+					if nibble&4 != 0 {
+						diff += step
+					}
+					if nibble&8 != 0 {
+						diff = -diff
+					}
+
+					predictors[c] = clamp(predictors[c]+diff, math.MinInt16, math.MaxInt16)
+					indices[c] = clamp(indices[c]+imaIndexTable[nibble], 0, len(imaStepTable)-1)
+
+					samples[c] = append(samples[c], int16(predictors[c]))
+				}
+			}
+		}
+
+		data = data[4*channels:]
+	}
+
+	return samples
+}
+
+func decodeMSBlock(block []byte, channels int, coefficients [][2]int16) [][]int16 {
+	samples := make([][]int16, channels)
+	if len(block) < 7*channels {
+		return samples
+	}
+
+	if len(coefficients) == 0 {
+		coefficients = msDefaultCoefficients
+	}
+
+	// the header holds each field for all the channels before moving on to
+	// the next field
+	coefficient := make([][2]int, channels)
+	delta := make([]int, channels)
+	sample1 := make([]int, channels)
+	sample2 := make([]int, channels)
+	for c := 0; c < channels; c++ {
+		predictor := int(block[c])
+		if predictor >= len(coefficients) {
+			predictor = 0
+		}
+		coefficient[c] = [2]int{int(coefficients[predictor][0]), int(coefficients[predictor][1])}
+		delta[c] = int(int16(binary.LittleEndian.Uint16(block[channels+2*c:])))
+		sample1[c] = int(int16(binary.LittleEndian.Uint16(block[3*channels+2*c:])))
+		sample2[c] = int(int16(binary.LittleEndian.Uint16(block[5*channels+2*c:])))
+
+		samples[c] = append(samples[c], int16(sample2[c]), int16(sample1[c]))
+	}
+
+	// the nibbles are interleaved, high nibble first, cycling through the channels
+	c := 0
+	for _, b := range block[7*channels:] {
+		for _, nibble := range [2]uint8{b >> 4, b & 0x0f} {
+			signed := int(nibble)
+			if signed >= 8 {
+				signed -= 16
+			}
+
+			predicted := (sample1[c]*coefficient[c][0] + sample2[c]*coefficient[c][1]) >> 8
+			sample := clamp(predicted+signed*delta[c], math.MinInt16, math.MaxInt16)
+
+			sample2[c] = sample1[c]
+			sample1[c] = sample
+			delta[c] = msAdaptationTable[nibble] * delta[c] >> 8
+			if delta[c] < 16 {
+				delta[c] = 16
+			}
+
+			samples[c] = append(samples[c], int16(sample))
+
+			c = (c + 1) % channels
+		}
+	}
+
+	return samples
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+
+	return v
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodingADPCMBlocks(t *testing.T) {
+	ima := []byte{
+		0x00, 0x00, 0x00, 0x00, // predictor 0, step index 0
+		0x07, 0x00, 0x00, 0x00,
+	}
+	expectedIMA := []int16{0, 11, 13, 14, 15, 16, 17, 18, 19}
+
+	given := decodeIMABlock(ima, 1)
+	if len(given[0]) != len(expectedIMA) {
+		t.Fatalf("expected %d IMA samples, given %d", len(expectedIMA), len(given[0]))
+	}
+	for i := range expectedIMA {
+		if expectedIMA[i] != given[0][i] {
+			t.Errorf("IMA sample %d: expected %d does not equal given %d", i, expectedIMA[i], given[0][i])
+		}
+	}
+
+	ms := []byte{
+		0x00,       // predictor 0
+		0x10, 0x00, // delta 16
+		0x64, 0x00, // sample1 100
+		0x32, 0x00, // sample2 50
+		0x1f,
+	}
+	expectedMS := []int16{50, 100, 116, 100}
+
+	given = decodeMSBlock(ms, 1, nil)
+	if len(given[0]) != len(expectedMS) {
+		t.Fatalf("expected %d MS ADPCM samples, given %d", len(expectedMS), len(given[0]))
+	}
+	for i := range expectedMS {
+		if expectedMS[i] != given[0][i] {
+			t.Errorf("MS ADPCM sample %d: expected %d does not equal given %d", i, expectedMS[i], given[0][i])
+		}
+	}
+}
+
+func TestCheckingSamplesPerBlock(t *testing.T) {
+	makeIMA := func(samplesPerBlock int16) []byte {
+		return makeRiff(
+			makeChunk("fmt ", FormatIMAADPCM, int16(1), int32(8000), int32(4000), int16(256), int16(4), int16(2), samplesPerBlock),
+			makeChunk("data", make([]byte, 256)),
+		)
+	}
+
+	if _, err := Parse(bytes.NewReader(makeIMA(505))); err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+
+	// a count the 256-byte blocks don't hold, which they're decoded to all
+	// the same when parsing leniently
+	if _, err := Parse(bytes.NewReader(makeIMA(500))); err == nil {
+		t.Errorf("expected an error for 500 samples per block")
+	}
+	wav, err := ParseWithOptions(bytes.NewReader(makeIMA(500)), Options{Lenient: true})
+	if err != nil {
+		t.Fatalf("failed parsing leniently: %v", err)
+	}
+	if len(wav.Problems) != 1 || len(wav.Data[0]) != 505 {
+		t.Errorf("expected 505 samples and a problem, given %d and %v", len(wav.Data[0]), wav.Problems)
+	}
+}
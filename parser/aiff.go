@@ -0,0 +1,276 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// aiffTextKeys maps the AIFF text chunks to the keys used in Wav.Metadata.
+var aiffTextKeys = map[string]string{
+	"NAME": "title",
+	"AUTH": "artist",
+	"(c) ": "copyright",
+	"ANNO": "comment",
+}
+
+// parseAiff reads an AIFF or AIFF-C file into the same structure that WAVE
+// files are read into; all the numbers in these files are big-endian.
+func parseAiff(cr *chunkReader, wav *Wav, options Options) error {
+	wav.ByteOrder = binary.BigEndian
+	wav.Signed = true
+
+	for {
+		offset := cr.offset
+
+		var chunkID [4]byte
+		var chunkSize uint32
+		if err := binary.Read(cr, binary.BigEndian, &chunkID); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err := wav.salvage(fmt.Errorf("failed reading the chunk ID: %w", truncated(err)), options); err != nil {
+				return err
+			}
+			break
+		}
+		if err := binary.Read(cr, binary.BigEndian, &chunkSize); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err := wav.salvage(fmt.Errorf("failed reading the chunk size: %w", truncated(err)), options); err != nil {
+				return err
+			}
+			break
+		}
+
+		chunkIDStr := string(chunkID[:])
+		size := int64(chunkSize)
+
+		if wav.ChunkID == [4]byte{} {
+			wav.ChunkID = chunkID
+			wav.ChunkSize = size
+
+			if err := binary.Read(cr, binary.BigEndian, &wav.Format); err != nil {
+				return chunkError(chunkIDStr, offset, err)
+			}
+			if string(wav.Format[:]) != "AIFF" && string(wav.Format[:]) != "AIFC" {
+				return fmt.Errorf("%w: not an AIFF file", ErrUnrecognized)
+			}
+			continue
+		}
+
+		// the last chunk of a truncated file is read as far as it goes
+		last := false
+		if options.Lenient {
+			size, last = clampChunkSize(cr, wav, chunkIDStr, offset, size)
+		}
+
+		if err := parseAiffChunk(cr, wav, chunkID, size, options); err != nil {
+			if err := wav.salvage(chunkError(chunkIDStr, offset, err), options); err != nil {
+				return err
+			}
+			if !skipPastChunk(cr, offset+8+size) {
+				break
+			}
+		}
+
+		if last {
+			break
+		}
+
+		if size%2 == 1 {
+			if err := cr.skip(1); err != nil && err != io.ErrUnexpectedEOF {
+				return fmt.Errorf("parse error: %w", err)
+			}
+		}
+	}
+
+	if wav.Subchunk1ID == [4]byte{} {
+		return fmt.Errorf("parse error: %w", ErrMissingFmt)
+	}
+
+	return nil
+}
+
+// parseAiffChunk reads a chunk of an AIFF or AIFF-C file after its header,
+// skipping the ones it doesn't know.
+func parseAiffChunk(cr *chunkReader, wav *Wav, chunkID [4]byte, size int64, options Options) error {
+	chunkIDStr := string(chunkID[:])
+	if key, ok := aiffTextKeys[chunkIDStr]; ok {
+		text, err := readChunk(cr, size)
+		if err != nil {
+			return err
+		}
+		wav.setMetadata(key, string(text))
+
+		return nil
+	}
+
+	switch chunkIDStr {
+	case "COMM":
+		wav.Subchunk1ID = chunkID
+		wav.Subchunk1Size = int32(size)
+
+		return parseComm(cr, wav, size)
+	case "SSND":
+		if wav.NumChannels == 0 {
+			return fmt.Errorf("%w: SSND chunk found before the COMM chunk", ErrMissingFmt)
+		}
+
+		// the sound data can start after an offset, used for aligning it,
+		// which has to be within the chunk
+		if size < 8 {
+			return fmt.Errorf("%w: SSND chunk of %d bytes", ErrChunkSize, size)
+		}
+		var offset, blockSize uint32
+		if err := binary.Read(cr, binary.BigEndian, &offset); err != nil {
+			return err
+		}
+		if err := binary.Read(cr, binary.BigEndian, &blockSize); err != nil {
+			return err
+		}
+		if int64(offset) > size-8 {
+			return fmt.Errorf("%w: SSND offset of %d in a chunk of %d bytes", ErrChunkSize, offset, size)
+		}
+		if err := cr.skip(int64(offset)); err != nil {
+			return err
+		}
+
+		wav.Subchunk2ID = chunkID
+		wav.Subchunk2Size = size - 8 - int64(offset)
+
+		return readData(cr, wav, options)
+	case "ID3 ":
+		return parseID3Chunk(cr, wav, size)
+	case "PEAK":
+		return parsePeak(cr, wav, size, binary.BigEndian)
+	case "MARK":
+		return parseMark(cr, wav, size)
+	}
+
+	return cr.skip(size)
+}
+
+func parseComm(r io.Reader, wav *Wav, chunkSize int64) error {
+	if chunkSize < 18 {
+		return fmt.Errorf("%w: COMM chunk of %d bytes", ErrChunkSize, chunkSize)
+	}
+
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	var comm struct {
+		NumChannels     int16
+		NumSampleFrames uint32
+		SampleSize      int16
+		SampleRate      [10]byte
+	}
+	if err := binary.Read(bytes.NewReader(chunk), binary.BigEndian, &comm); err != nil {
+		return err
+	}
+
+	wav.NumChannels = comm.NumChannels
+	wav.SampleRate = int32(math.Round(parseExtended(comm.SampleRate)))
+	wav.SampleLength = int64(comm.NumSampleFrames)
+	wav.AudioFormat = FormatPCM
+
+	// the samples are stored in whole bytes, left-justified
+	bits := comm.SampleSize
+	wav.BitsPerSample = (bits + 7) / 8 * 8
+	if bits != wav.BitsPerSample {
+		wav.ValidBitsPerSample = bits
+	}
+
+	// AIFF-C adds the compression type, followed by its name
+	if string(wav.Format[:]) == "AIFC" && len(chunk) >= 22 {
+		compression := string(chunk[18:22])
+		switch compression {
+		case "NONE", "twos":
+		case "sowt":
+			wav.ByteOrder = binary.LittleEndian
+		case "raw ":
+			wav.Signed = false
+		case "fl32", "FL32":
+			wav.AudioFormat = FormatIEEEFloat
+			wav.BitsPerSample = 32
+		case "fl64", "FL64":
+			wav.AudioFormat = FormatIEEEFloat
+			wav.BitsPerSample = 64
+		case "alaw", "ALAW":
+			wav.AudioFormat = FormatALaw
+			wav.BitsPerSample = 8
+		case "ulaw", "ULAW":
+			wav.AudioFormat = FormatMuLaw
+			wav.BitsPerSample = 8
+		default:
+			return fmt.Errorf("unsupported AIFF-C compression type %q", compression)
+		}
+	}
+
+	wav.BlockAlign = wav.NumChannels * wav.BitsPerSample / 8
+	wav.ByteRate = wav.SampleRate * int32(wav.BlockAlign)
+
+	return nil
+}
+
+// parseExtended converts an 80-bit IEEE 754 extended precision number, which
+// is how AIFF stores the sample rate.
+func parseExtended(b [10]byte) float64 {
+	sign := 1.0
+	if b[0]&0x80 != 0 {
+		sign = -1
+	}
+	exponent := int(binary.BigEndian.Uint16(b[0:2]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+
+	return sign * math.Ldexp(float64(mantissa), exponent-16383-63)
+}
+
+func parseMark(r io.Reader, wav *Wav, chunkSize int64) error {
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	if len(chunk) < 2 {
+		return nil
+	}
+
+	// each marker has an ID, a position and a name stored as a Pascal
+	// string, padded to an even length
+	count := int(binary.BigEndian.Uint16(chunk))
+	markers := chunk[2:]
+	for i := 0; i < count && len(markers) >= 7; i++ {
+		id := uint32(binary.BigEndian.Uint16(markers))
+		position := int64(binary.BigEndian.Uint32(markers[2:]))
+		nameLength := int(markers[6])
+
+		end := 7 + nameLength
+		if end > len(markers) {
+			break
+		}
+
+		marker := wav.getMarker(id)
+		marker.Offset = position
+		marker.Label = fixedString(markers[7:end])
+
+		if end%2 == 1 {
+			end++
+		}
+		if end > len(markers) {
+			end = len(markers)
+		}
+		markers = markers[end:]
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func makeAiff(form string, chunks ...[]byte) []byte {
+	var body bytes.Buffer
+	body.WriteString(form)
+	for _, c := range chunks {
+		body.Write(c)
+	}
+
+	var aiff bytes.Buffer
+	aiff.WriteString("FORM")
+	_ = binary.Write(&aiff, binary.BigEndian, uint32(body.Len()))
+	aiff.Write(body.Bytes())
+
+	return aiff.Bytes()
+}
+
+func makeAiffChunk(id string, fields ...interface{}) []byte {
+	var payload bytes.Buffer
+	for _, f := range fields {
+		_ = binary.Write(&payload, binary.BigEndian, f)
+	}
+
+	var chunk bytes.Buffer
+	chunk.WriteString(id)
+	_ = binary.Write(&chunk, binary.BigEndian, uint32(payload.Len()))
+	chunk.Write(payload.Bytes())
+	if payload.Len()%2 == 1 {
+		chunk.WriteByte(0)
+	}
+
+	return chunk.Bytes()
+}
+
+// 44100 as an 80-bit extended float
+var extended44100 = [10]byte{0x40, 0x0e, 0xac, 0x44, 0, 0, 0, 0, 0, 0}
+
+func TestParsingAiff(t *testing.T) {
+	data := makeAiff("AIFF",
+		makeAiffChunk("COMM", int16(2), uint32(2), int16(16), extended44100),
+		makeAiffChunk("NAME", []byte("Loop")),
+		makeAiffChunk("MARK", uint16(1), uint16(1), uint32(1), []byte{3, 'C', 'u', 'e'}),
+		makeAiffChunk("SSND", uint32(0), uint32(0), []int16{-16384, 16384, 0, -32768}),
+	)
+
+	wav, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	if err := wav.CheckFormat(); err != nil {
+		t.Fatalf("validation failed: %v", err)
+	}
+
+	if wav.SampleRate != 44100 || wav.NumChannels != 2 || wav.BitsPerSample != 16 {
+		t.Errorf("unexpected format: %d Hz, %d channels, %d-bit", wav.SampleRate, wav.NumChannels, wav.BitsPerSample)
+	}
+	if wav.GetNumSamples() != 2 {
+		t.Errorf("expected 2 samples, given %d", wav.GetNumSamples())
+	}
+
+	expected := [][]float32{{-0.5, 0}, {0.5, -1}}
+	for c := range expected {
+		for i := range expected[c] {
+			if wav.Data[c][i] != expected[c][i] {
+				t.Errorf("expected %f does not equal given %f", expected[c][i], wav.Data[c][i])
+			}
+		}
+	}
+
+	if wav.Metadata["title"] != "Loop" {
+		t.Errorf("expected the Loop title, given %q", wav.Metadata["title"])
+	}
+	if len(wav.Markers) != 1 || wav.Markers[0].Label != "Cue" || wav.Markers[0].Offset != 1 {
+		t.Errorf("unexpected markers %+v", wav.Markers)
+	}
+}
+
+func TestParsingAiffCompressionTypes(t *testing.T) {
+	tests := []struct {
+		compression string
+		sampleSize  int16
+		samples     interface{}
+		expected    float32
+	}{
+		{"sowt", 16, []byte{0x00, 0xc0}, -0.5},
+		{"fl32", 32, []float32{0.25}, 0.25},
+		{"NONE", 8, []int8{-64}, -0.5},
+	}
+
+	for _, test := range tests {
+		data := makeAiff("AIFC",
+			makeAiffChunk("COMM", int16(1), uint32(1), test.sampleSize, extended44100, []byte(test.compression), []byte{0}),
+			makeAiffChunk("SSND", uint32(0), uint32(0), test.samples),
+		)
+
+		wav, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed parsing %s: %v", test.compression, err)
+		}
+		if wav.Data[0][0] != test.expected {
+			t.Errorf("%s: expected %f does not equal given %f", test.compression, test.expected, wav.Data[0][0])
+		}
+	}
+}
+
+func TestParsingAiffWithoutComm(t *testing.T) {
+	for _, data := range [][]byte{
+		makeAiff("AIFF", makeAiffChunk("NAME", []byte("Loop"))),
+		makeAiff("AIFF", makeAiffChunk("SSND", uint32(0), uint32(0), []int16{0, 1})),
+	} {
+		if _, err := Parse(bytes.NewReader(data)); !errors.Is(err, ErrMissingFmt) {
+			t.Errorf("expected a missing COMM chunk error, given %v", err)
+		}
+	}
+}
+
+func TestParsingAiffSoundOffset(t *testing.T) {
+	comm := makeAiffChunk("COMM", int16(1), uint32(2), int16(16), extended44100)
+
+	// the samples start after 2 bytes of padding
+	data := makeAiff("AIFF", comm, makeAiffChunk("SSND", uint32(2), uint32(0), []int16{0, 16384, -16384}))
+	wav, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	if wav.GetNumSamples() != 2 || wav.Data[0][0] != 0.5 || wav.Data[0][1] != -0.5 {
+		t.Errorf("expected the samples after the offset, given %v", wav.Data)
+	}
+
+	// an offset past the end of the chunk, with enough bytes after it
+	// to seek to, and a chunk too small for the offset
+	for _, ssnd := range [][]byte{
+		makeAiffChunk("SSND", uint32(100), uint32(0)),
+		makeAiffChunk("SSND", uint16(0)),
+	} {
+		data := append(makeAiff("AIFF", comm, ssnd), make([]byte, 200)...)
+		if _, err := Parse(bytes.NewReader(data)); !errors.Is(err, ErrChunkSize) {
+			t.Errorf("expected a chunk size error, given %v", err)
+		}
+	}
+}
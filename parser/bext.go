@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// BroadcastExtension holds the bext chunk of a Broadcast Wave file, as
+// described in EBU Tech 3285.
+type BroadcastExtension struct {
+	Description         string
+	Originator          string
+	OriginatorReference string
+	OriginationDate     string // yyyy-mm-dd
+	OriginationTime     string // hh:mm:ss
+	TimeReference       uint64 // first sample's offset from midnight, in samples
+	Version             uint16
+	UMID                [64]byte
+
+	// loudness values, only set from version 2 on
+	LoudnessValue        float64 // LUFS
+	LoudnessRange        float64 // LU
+	MaxTruePeakLevel     float64 // dBTP
+	MaxMomentaryLoudness float64 // LUFS
+	MaxShortTermLoudness float64 // LUFS
+
+	CodingHistory string
+}
+
+// bextFixedSize is the size of the bext chunk without the coding history.
+const bextFixedSize = 602
+
+func parseBext(r io.Reader, wav *Wav, chunkSize int64) error {
+	if chunkSize < bextFixedSize {
+		return fmt.Errorf("%w: bext chunk of %d bytes", ErrChunkSize, chunkSize)
+	}
+
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	var raw struct {
+		Description          [256]byte
+		Originator           [32]byte
+		OriginatorReference  [32]byte
+		OriginationDate      [10]byte
+		OriginationTime      [8]byte
+		TimeReference        uint64
+		Version              uint16
+		UMID                 [64]byte
+		LoudnessValue        int16
+		LoudnessRange        int16
+		MaxTruePeakLevel     int16
+		MaxMomentaryLoudness int16
+		MaxShortTermLoudness int16
+	}
+	if err := binary.Read(bytes.NewReader(chunk), wav.byteOrder(), &raw); err != nil {
+		return err
+	}
+
+	bext := &BroadcastExtension{
+		Description:         fixedString(raw.Description[:]),
+		Originator:          fixedString(raw.Originator[:]),
+		OriginatorReference: fixedString(raw.OriginatorReference[:]),
+		OriginationDate:     fixedString(raw.OriginationDate[:]),
+		OriginationTime:     fixedString(raw.OriginationTime[:]),
+		TimeReference:       raw.TimeReference,
+		Version:             raw.Version,
+		UMID:                raw.UMID,
+		CodingHistory:       fixedString(chunk[bextFixedSize:]),
+	}
+
+	if bext.Version >= 2 {
+		// stored as hundredths
+		bext.LoudnessValue = float64(raw.LoudnessValue) / 100
+		bext.LoudnessRange = float64(raw.LoudnessRange) / 100
+		bext.MaxTruePeakLevel = float64(raw.MaxTruePeakLevel) / 100
+		bext.MaxMomentaryLoudness = float64(raw.MaxMomentaryLoudness) / 100
+		bext.MaxShortTermLoudness = float64(raw.MaxShortTermLoudness) / 100
+	}
+
+	wav.Bext = bext
+
+	return nil
+}
+
+// fixedString reads a text field that is NUL-terminated or NUL-padded.
+func fixedString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// HasLoudness reports whether the chunk carries the loudness values.
+func (b *BroadcastExtension) HasLoudness() bool {
+	return b.Version >= 2
+}
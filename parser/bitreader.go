@@ -0,0 +1,97 @@
+package parser
+
+import "io"
+
+// bitReader reads big-endian bit fields, most significant bit first, as used
+// by FLAC and MPEG audio.
+type bitReader struct {
+	r     io.ByteReader
+	cache uint64 // the unread bits, aligned to the right
+	n     uint   // number of bits in the cache
+}
+
+func newBitReader(r io.ByteReader) *bitReader {
+	return &bitReader{r: r}
+}
+
+// readBits reads an unsigned number of up to 56 bits.
+func (br *bitReader) readBits(n uint) (uint64, error) {
+	for br.n < n {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && br.n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		br.cache = br.cache<<8 | uint64(b)
+		br.n += 8
+	}
+
+	br.n -= n
+	v := br.cache >> br.n
+	br.cache &= 1<<br.n - 1
+
+	return v, nil
+}
+
+// readSignedBits reads a two's complement number of up to 56 bits.
+func (br *bitReader) readSignedBits(n uint) (int64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+
+	v, err := br.readBits(n)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+func (br *bitReader) readBit() (bool, error) {
+	v, err := br.readBits(1)
+
+	return v == 1, err
+}
+
+// readUnary counts the zero bits before the next one bit.
+func (br *bitReader) readUnary() (uint64, error) {
+	var count uint64
+	for {
+		if br.n == 0 {
+			b, err := br.r.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+			br.cache = uint64(b)
+			br.n = 8
+		}
+
+		// the cache only holds the unread bits, so the leading zeros can be
+		// counted all at once
+		if br.cache == 0 {
+			count += uint64(br.n)
+			br.n = 0
+			continue
+		}
+
+		for br.cache>>(br.n-1) == 0 {
+			count++
+			br.n--
+		}
+		br.n--
+		br.cache &= 1<<br.n - 1
+
+		return count, nil
+	}
+}
+
+// align discards the bits up to the next byte boundary.
+func (br *bitReader) align() {
+	br.n -= br.n % 8
+	br.cache &= 1<<br.n - 1
+}
@@ -0,0 +1,238 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// cafInfoKeys maps the keys of the CAF info chunk to the keys used in
+// Wav.Metadata; the other keys are kept as they are.
+var cafInfoKeys = map[string]string{
+	"comments":             "comment",
+	"year":                 "date",
+	"recorded date":        "date",
+	"track number":         "track",
+	"encoding application": "software",
+}
+
+// the flags of the linear PCM format
+const (
+	cafFloat        = 1 << 0
+	cafLittleEndian = 1 << 1
+)
+
+// parseCaf reads an Apple Core Audio Format file into the same structure that
+// WAVE files are read into; the chunk headers are big-endian, with 64-bit
+// sizes, and the chunks aren't padded.
+func parseCaf(cr *chunkReader, wav *Wav, options Options) error {
+	var header struct {
+		ID      [4]byte
+		Version uint16
+		Flags   uint16
+	}
+	if err := binary.Read(cr, binary.BigEndian, &header); err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+	if header.Version != 1 {
+		return fmt.Errorf("%w: unsupported CAF version %d", ErrUnrecognized, header.Version)
+	}
+	wav.ChunkID = header.ID
+
+	for {
+		offset := cr.offset
+
+		var chunkID [4]byte
+		var chunkSize int64
+		if err := binary.Read(cr, binary.BigEndian, &chunkID); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err := wav.salvage(fmt.Errorf("failed reading the chunk ID: %w", truncated(err)), options); err != nil {
+				return err
+			}
+			break
+		}
+		if err := binary.Read(cr, binary.BigEndian, &chunkSize); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err := wav.salvage(fmt.Errorf("failed reading the chunk size: %w", truncated(err)), options); err != nil {
+				return err
+			}
+			break
+		}
+
+		chunkIDStr := string(chunkID[:])
+		size := chunkSize
+		if chunkIDStr == "data" && chunkSize == -1 {
+			// the size of the last chunk can be left unknown, in which case
+			// it runs until EOF like the data of streamed WAVE files
+			size = unknownSize
+		} else if chunkSize < 0 {
+			// there's no telling where the next chunk starts
+			if err := wav.salvage(chunkError(chunkIDStr, offset, ErrChunkSize), options); err != nil {
+				return err
+			}
+			break
+		}
+
+		last := false
+		if options.Lenient {
+			size, last = clampChunkSize(cr, wav, chunkIDStr, offset, size)
+		}
+
+		if err := parseCafChunk(cr, wav, chunkID, size, options); err != nil {
+			if err := wav.salvage(chunkError(chunkIDStr, offset, err), options); err != nil {
+				return err
+			}
+			if size == unknownSize || !skipPastChunk(cr, offset+12+size) {
+				break
+			}
+		}
+
+		if last {
+			break
+		}
+	}
+
+	// CAF files have no overall size, so it's made up to match GetFileSize
+	wav.ChunkSize = cr.offset - 8
+
+	if wav.Subchunk1ID == [4]byte{} {
+		return fmt.Errorf("parse error: %w", ErrMissingFmt)
+	}
+
+	return nil
+}
+
+// parseCafChunk reads a chunk of a CAF file, skipping the ones it doesn't
+// know; size is unknownSize for a data chunk that runs until EOF.
+func parseCafChunk(cr *chunkReader, wav *Wav, chunkID [4]byte, size int64, options Options) error {
+	switch string(chunkID[:]) {
+	case "desc":
+		wav.Subchunk1ID = chunkID
+		wav.Subchunk1Size = int32(size)
+
+		return parseDesc(cr, wav, size)
+	case "data":
+		if wav.NumChannels == 0 {
+			return ErrMissingFmt
+		}
+		if size < 4 {
+			return fmt.Errorf("%w: data chunk of %d bytes", ErrChunkSize, size)
+		}
+
+		// the audio follows an edit count
+		var editCount uint32
+		if err := binary.Read(cr, binary.BigEndian, &editCount); err != nil {
+			return err
+		}
+
+		wav.Subchunk2ID = chunkID
+		wav.Subchunk2Size = size - 4
+		if size == unknownSize {
+			wav.Subchunk2Size = unknownSize
+		}
+
+		return readData(cr, wav, options)
+	case "peak":
+		return parseCafPeak(cr, wav, size)
+	case "info":
+		return parseCafInfo(cr, wav, size)
+	default:
+		return cr.skip(size)
+	}
+}
+
+func parseDesc(r io.Reader, wav *Wav, chunkSize int64) error {
+	if chunkSize < 32 {
+		return fmt.Errorf("%w: desc chunk of %d bytes", ErrChunkSize, chunkSize)
+	}
+
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	var desc struct {
+		SampleRate       float64
+		FormatID         [4]byte
+		FormatFlags      uint32
+		BytesPerPacket   uint32
+		FramesPerPacket  uint32
+		ChannelsPerFrame uint32
+		BitsPerChannel   uint32
+	}
+	if err := binary.Read(bytes.NewReader(chunk), binary.BigEndian, &desc); err != nil {
+		return err
+	}
+	if desc.ChannelsPerFrame == 0 || desc.ChannelsPerFrame > math.MaxInt16 {
+		return fmt.Errorf("invalid number of channels: %d", desc.ChannelsPerFrame)
+	}
+
+	wav.NumChannels = int16(desc.ChannelsPerFrame)
+	wav.SampleRate = int32(math.Round(desc.SampleRate))
+	wav.Signed = true
+	wav.ByteOrder = binary.BigEndian
+
+	switch formatID := string(desc.FormatID[:]); formatID {
+	case "lpcm":
+		wav.AudioFormat = FormatPCM
+		if desc.FormatFlags&cafFloat != 0 {
+			wav.AudioFormat = FormatIEEEFloat
+		}
+		if desc.FormatFlags&cafLittleEndian != 0 {
+			wav.ByteOrder = binary.LittleEndian
+		}
+	case "alaw":
+		wav.AudioFormat = FormatALaw
+	case "ulaw":
+		wav.AudioFormat = FormatMuLaw
+	default:
+		return fmt.Errorf("unsupported CAF format %q", formatID)
+	}
+
+	// the samples can be stored in wider containers than their precision,
+	// left-justified like in AIFF files
+	bits := int16(desc.BitsPerChannel)
+	wav.BitsPerSample = (bits + 7) / 8 * 8
+	if container := int16(desc.BytesPerPacket / desc.ChannelsPerFrame * 8); desc.FramesPerPacket == 1 && container > wav.BitsPerSample {
+		wav.BitsPerSample = container
+	}
+	if bits != wav.BitsPerSample {
+		wav.ValidBitsPerSample = bits
+	}
+
+	wav.BlockAlign = wav.NumChannels * wav.BitsPerSample / 8
+	wav.ByteRate = wav.SampleRate * int32(wav.BlockAlign)
+
+	return nil
+}
+
+// parseCafInfo reads the info chunk, which holds a count followed by pairs
+// of NUL-terminated keys and values.
+func parseCafInfo(r io.Reader, wav *Wav, chunkSize int64) error {
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+	if len(chunk) < 4 {
+		return nil
+	}
+
+	strs := strings.Split(string(chunk[4:]), "\x00")
+	for i := 0; i+1 < len(strs); i += 2 {
+		key, ok := cafInfoKeys[strs[i]]
+		if !ok {
+			key = strs[i]
+		}
+
+		wav.setMetadata(key, strs[i+1])
+	}
+
+	return nil
+}
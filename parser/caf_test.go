@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func makeCafChunk(id string, size int64, fields ...interface{}) []byte {
+	var payload bytes.Buffer
+	for _, f := range fields {
+		_ = binary.Write(&payload, binary.BigEndian, f)
+	}
+	if size == 0 {
+		size = int64(payload.Len())
+	}
+
+	var chunk bytes.Buffer
+	chunk.WriteString(id)
+	_ = binary.Write(&chunk, binary.BigEndian, size)
+	chunk.Write(payload.Bytes())
+
+	return chunk.Bytes()
+}
+
+func TestParsingCaf(t *testing.T) {
+	tests := []struct {
+		flags, bits, bytesPerPacket uint32
+		dataSize                    int64
+		samples                     []byte
+		expected                    []float32
+	}{
+		// big-endian 16-bit integers
+		{0, 16, 4, 0, []byte{0xc0, 0x00, 0x40, 0x00, 0x00, 0x00, 0x80, 0x00}, []float32{-0.5, 0.5, 0, -1}},
+		// little-endian floats, with a data chunk that runs until EOF
+		{cafFloat | cafLittleEndian, 32, 8, -1, []byte{0, 0, 0x80, 0x3e, 0, 0, 0x80, 0xbe}, []float32{0.25, -0.25}},
+		// 24-bit integers in 32-bit containers
+		{0, 24, 8, 0, []byte{0x40, 0, 0, 0, 0xc0, 0, 0, 0}, []float32{0.5, -0.5}},
+	}
+
+	for _, test := range tests {
+		var caf bytes.Buffer
+		caf.WriteString("caff\x00\x01\x00\x00")
+		caf.Write(makeCafChunk("desc", 0, float64(44100), []byte("lpcm"), test.flags, test.bytesPerPacket, uint32(1), uint32(2), test.bits))
+		caf.Write(makeCafChunk("info", 0, uint32(2), []byte("title\x00Take\x00track number\x003\x00")))
+		caf.Write(makeCafChunk("peak", 0, uint32(1), float32(1), uint64(3), float32(0.5), uint64(0)))
+		caf.Write(makeCafChunk("data", test.dataSize, uint32(0), test.samples))
+
+		wav, err := Parse(bytes.NewReader(caf.Bytes()))
+		if err != nil {
+			t.Fatalf("failed parsing %d-bit samples: %v", test.bits, err)
+		}
+		if err := wav.CheckFormat(); err != nil {
+			t.Fatalf("validation failed: %v", err)
+		}
+
+		if wav.SampleRate != 44100 || wav.NumChannels != 2 {
+			t.Errorf("unexpected format: %d Hz, %d channels", wav.SampleRate, wav.NumChannels)
+		}
+		if n := wav.GetNumSamples(); n != int64(len(test.expected)/2) {
+			t.Errorf("expected %d samples, given %d", len(test.expected)/2, n)
+		}
+		for i, s := range test.expected {
+			if given := wav.Data[i%2][i/2]; given != s {
+				t.Errorf("%d-bit: expected %f does not equal given %f", test.bits, s, given)
+			}
+		}
+
+		if wav.Metadata["title"] != "Take" || wav.Metadata["track"] != "3" {
+			t.Errorf("unexpected metadata: %v", wav.Metadata)
+		}
+		if wav.PeakChunk == nil || len(wav.PeakChunk.Peaks) != 2 || wav.PeakChunk.Peaks[0] != (PositionPeak{1, 3}) {
+			t.Errorf("unexpected peak chunk %+v", wav.PeakChunk)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// speakerPositions are the speaker positions of the bits of the channel mask
+// of WAVE_FORMAT_EXTENSIBLE files, from the lowest one.
+var speakerPositions = []string{
+	"FL", "FR", "FC", "LFE", "BL", "BR", "FLC", "FRC", "BC", "SL", "SR",
+	"TC", "TFL", "TFC", "TFR", "TBL", "TBC", "TBR",
+}
+
+// defaultChannelMasks are the layouts of the files that have no channel
+// mask, by their number of channels: mono, stereo, 3.0, quad, 5.0, 5.1, 6.1
+// and 7.1, which FLAC mandates and most other formats follow, but not AIFF.
+var defaultChannelMasks = map[int16]uint32{
+	1: 0x4,
+	2: 0x3,
+	3: 0x7,
+	4: 0x33,
+	5: 0x37,
+	6: 0x3F,
+	7: 0x70F,
+	8: 0x63F,
+}
+
+// aiffChannelLayouts are the speaker positions that the AIFF specification
+// gives the channels of files with more than 2 of them, which no channel
+// mask can describe, as they aren't in the order of the mask bits. It leaves
+// 4 channels ambiguous, as quad and LCRS, and has no layout for 5, 7 or 8.
+var aiffChannelLayouts = map[int16][]string{
+	3: {"FL", "FR", "FC"},
+	6: {"FL", "FLC", "FC", "FR", "FRC", "BC"},
+}
+
+// GetChannelLayout returns the speaker position of each channel, like "FL"
+// or "LFE", from the channel mask or, if there's none, from the default
+// layout for the number of channels; the channels the layout doesn't cover
+// are left blank.
+func (w *Wav) GetChannelLayout() []string {
+	if w.NumChannels <= 0 {
+		return nil
+	}
+
+	if string(w.ChunkID[:]) == "FORM" && w.NumChannels > 2 {
+		layout := make([]string, w.NumChannels)
+		copy(layout, aiffChannelLayouts[w.NumChannels])
+		return layout
+	}
+
+	// a mask of 0 is meant for channels that go to no speaker in particular,
+	// but it's mostly left that way by writers that didn't care to set it
+	mask := w.ChannelMask
+	if !w.IsExtensible() || mask == 0 {
+		mask = defaultChannelMasks[w.NumChannels]
+	}
+
+	layout := make([]string, w.NumChannels)
+	ch := 0
+	for bit, position := range speakerPositions {
+		if ch == len(layout) {
+			break
+		}
+		if mask&(1<<bit) != 0 {
+			layout[ch] = position
+			ch++
+		}
+	}
+
+	return layout
+}
+
+// GetChannelLabel describes a channel, counted from 0, by its speaker
+// position and its iXML track name, e.g. "FL Boom", or by its number from 1
+// when it has neither.
+func (w *Wav) GetChannelLabel(channel int) string {
+	var names []string
+	if layout := w.GetChannelLayout(); channel < len(layout) && layout[channel] != "" {
+		names = append(names, layout[channel])
+	}
+	if name := w.GetChannelName(channel); name != "" {
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return strconv.Itoa(channel + 1)
+	}
+
+	return strings.Join(names, " ")
+}
+
+// FindChannel returns the index, from 0, of the channel given by its number
+// from 1, its speaker position or its iXML track name, ignoring case.
+func (w *Wav) FindChannel(name string) (int, bool) {
+	if n, err := strconv.Atoi(name); err == nil {
+		return n - 1, n >= 1 && n <= int(w.NumChannels)
+	}
+
+	for ch, position := range w.GetChannelLayout() {
+		if position != "" && strings.EqualFold(position, name) {
+			return ch, true
+		}
+	}
+	for ch := 0; ch < int(w.NumChannels); ch++ {
+		if trackName := w.GetChannelName(ch); trackName != "" && strings.EqualFold(trackName, name) {
+			return ch, true
+		}
+	}
+
+	return 0, false
+}
+
+// selectChannel finds the channel of Options.Channel, once the format is
+// known; only the track names of an iXML chunk that comes before the
+// samples can be used.
+func (w *Wav) selectChannel(options Options) error {
+	if options.Channel == "" {
+		return nil
+	}
+
+	ch, ok := w.FindChannel(options.Channel)
+	if !ok {
+		return &ChannelError{Channel: options.Channel, NumChannels: int(w.NumChannels)}
+	}
+	w.SelectedChannel = ch + 1
+
+	return nil
+}
+
+// selectedSamples returns the selected channel of a block of samples, or
+// all of the channels when none is selected.
+func (w *Wav) selectedSamples(samples [][]float32) [][]float32 {
+	if ch := w.SelectedChannel; ch > 0 && ch <= len(samples) {
+		return samples[ch-1 : ch]
+	}
+
+	return samples
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"io"
+	"sort"
+)
+
+// Marker is a cue point, along with the labels attached to it by the LIST/adtl
+// chunk; markers with a length are regions.
+type Marker struct {
+	ID     uint32
+	Offset int64 // in samples per channel, from the start of the data
+	Length int64 // in samples per channel, 0 for markers that aren't regions
+	Label  string
+	Note   string
+}
+
+func (m *Marker) IsRegion() bool {
+	return m.Length > 0
+}
+
+// getMarker returns the marker with the given ID, adding it if it's not there
+// yet; the cue and adtl chunks can come in any order.
+func (w *Wav) getMarker(id uint32) *Marker {
+	for i := range w.Markers {
+		if w.Markers[i].ID == id {
+			return &w.Markers[i]
+		}
+	}
+
+	w.Markers = append(w.Markers, Marker{ID: id})
+
+	return &w.Markers[len(w.Markers)-1]
+}
+
+func (w *Wav) sortMarkers() {
+	sort.SliceStable(w.Markers, func(i, j int) bool {
+		return w.Markers[i].Offset < w.Markers[j].Offset
+	})
+}
+
+func parseCue(r io.Reader, wav *Wav, chunkSize int64) error {
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	if len(chunk) < 4 {
+		return nil
+	}
+
+	// each cue point takes 24 bytes: ID, position, data chunk ID, chunk
+	// start, block start and sample offset
+	byteOrder := wav.byteOrder()
+	count := int(byteOrder.Uint32(chunk))
+	points := chunk[4:]
+	for i := 0; i < count && len(points) >= 24; i++ {
+		marker := wav.getMarker(byteOrder.Uint32(points))
+		marker.Offset = int64(byteOrder.Uint32(points[20:]))
+
+		points = points[24:]
+	}
+
+	return nil
+}
+
+func parseAdtlList(wav *Wav, subchunks []subchunk) {
+	for _, sub := range subchunks {
+		if len(sub.data) < 4 {
+			continue
+		}
+
+		marker := wav.getMarker(wav.byteOrder().Uint32(sub.data))
+
+		switch sub.id {
+		case "labl":
+			marker.Label = fixedString(sub.data[4:])
+		case "note":
+			marker.Note = fixedString(sub.data[4:])
+		case "ltxt":
+			// cue point ID, sample length, purpose ID, country, language,
+			// dialect and code page, followed by the text
+			if len(sub.data) < 20 {
+				continue
+			}
+			marker.Length = int64(wav.byteOrder().Uint32(sub.data[4:]))
+			if text := fixedString(sub.data[20:]); text != "" && marker.Label == "" {
+				marker.Label = text
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The errors Parse can return, or wrap, for input it can't read; test for
+// them with errors.Is.
+var (
+	// ErrUnrecognized is returned for input in none of the supported formats.
+	ErrUnrecognized = errors.New("unrecognized format")
+
+	// ErrTruncated is returned when the input ends in the middle of a chunk.
+	ErrTruncated = errors.New("unexpected end of input")
+
+	// ErrChunkSize is returned for chunk sizes that can't be right, like
+	// negative ones or ones too small for what the chunk has to hold.
+	ErrChunkSize = errors.New("invalid chunk size")
+
+	// ErrMissingFmt is returned when there's no fmt chunk before the data.
+	ErrMissingFmt = errors.New("missing fmt chunk")
+)
+
+// ChunkError is the error of reading a chunk of a WAVE, Wave64, AIFF or CAF
+// file.
+type ChunkError struct {
+	ID     string // e.g. "fmt " or "data"
+	Offset int64  // of the chunk header, from the start of the input
+	Err    error  // one of the errors above, or the error of the reader
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("parse error: %q chunk at offset %d: %v", e.ID, e.Offset, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// ChannelError is returned when Options.Channel names none of the channels;
+// it's a bad option rather than a damaged file, so it's never salvaged nor
+// tied to a chunk.
+type ChannelError struct {
+	Channel     string
+	NumChannels int
+}
+
+func (e *ChannelError) Error() string {
+	return fmt.Sprintf("no channel %q among the %d channels", e.Channel, e.NumChannels)
+}
+
+// channelError finds the ChannelError that ended a parse, if any, to report
+// it apart from the chunk it was found in.
+func channelError(err error) error {
+	var channelErr *ChannelError
+	if errors.As(err, &channelErr) {
+		return channelErr
+	}
+
+	return err
+}
+
+// chunkError wraps the error of reading a chunk, telling the input running
+// out apart from the other errors.
+func chunkError(id string, offset int64, err error) *ChunkError {
+	return &ChunkError{ID: id, Offset: offset, Err: truncated(err)}
+}
+
+// truncated turns the errors of reading past the end of the input into
+// ErrTruncated.
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	}
+
+	return err
+}
+
+// salvage records an error that Options.Lenient parsing gets past, returning
+// it as it is otherwise.
+func (w *Wav) salvage(err error, options Options) error {
+	var channelErr *ChannelError
+	if !options.Lenient || errors.As(err, &channelErr) {
+		return err
+	}
+
+	w.Problems = append(w.Problems, err)
+
+	return nil
+}
+
+// clampChunkSize cuts the size of a chunk that runs past the end of the input,
+// when the reader can tell where that is, recording it as a problem; it
+// reports whether the size was cut.
+func clampChunkSize(cr *chunkReader, wav *Wav, id string, offset, size int64) (int64, bool) {
+	if id == "data" && size == unknownSize {
+		// streamed data, which runs until EOF anyway
+		return size, false
+	}
+
+	remaining, ok := cr.remaining()
+	if !ok || size <= remaining {
+		return size, false
+	}
+
+	wav.Problems = append(wav.Problems, chunkError(id, offset, ErrTruncated))
+
+	return remaining, true
+}
+
+// skipPastChunk moves on to the end of a chunk that couldn't be read,
+// reporting false when that's not possible.
+func skipPastChunk(cr *chunkReader, end int64) bool {
+	if cr.offset > end {
+		return false
+	}
+
+	return cr.skip(end-cr.offset) == nil
+}
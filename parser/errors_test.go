@@ -0,0 +1,168 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makePCMFmt builds the fmt chunk of a 16-bit stereo file.
+func makePCMFmt() []byte {
+	return makeChunk("fmt ", FormatPCM, int16(2), int32(48000), int32(192000), int16(4), int16(16))
+}
+
+func TestParsingMalformedFiles(t *testing.T) {
+	samples := makeChunk("data", []int16{1, 2, 3, 4, 5, 6})
+	truncatedData := makeRiff(makePCMFmt(), samples)
+	truncatedData = truncatedData[:len(truncatedData)-3]
+
+	hugeList := makeRiff(makePCMFmt(), []byte("LIST\xf0\xff\xff\x7fINFO"))
+	waveGUID := w64GUID("wave")
+
+	cafDesc := makeCafChunk("desc", 0, float64(44100), []byte("lpcm"), uint32(0), uint32(2), uint32(1), uint32(1), uint32(16))
+	cafData := makeCafChunk("data", 0, uint32(0), []int16{1, 2, 3})
+	truncatedCaf := append([]byte("caff\x00\x01\x00\x00"), append(cafDesc, cafData...)...)
+	truncatedCaf = truncatedCaf[:len(truncatedCaf)-3]
+
+	aiffComm := makeAiffChunk("COMM", int16(2), uint32(3), int16(16), extended44100)
+	truncatedAiff := makeAiff("AIFF", aiffComm, makeAiffChunk("SSND", uint32(0), uint32(0), []int16{1, 2, 3, 4, 5, 6}))
+	truncatedAiff = truncatedAiff[:len(truncatedAiff)-3]
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+		chunk    string
+	}{
+		{"empty", nil, ErrUnrecognized, ""},
+		{"unknown", []byte("JUNKJUNK"), ErrUnrecognized, ""},
+		{"no fmt", makeRiff(samples), ErrMissingFmt, "data"},
+		{"small fmt", makeRiff(makeChunk("fmt ", FormatPCM, int16(2)), samples), ErrChunkSize, "fmt "},
+		{"truncated data", truncatedData, ErrTruncated, "data"},
+		{"huge LIST", hugeList, ErrTruncated, "LIST"},
+		{"truncated header", makeRiff(makePCMFmt(), samples, []byte("LI")), ErrTruncated, ""},
+		{"caf without desc", append([]byte("caff\x00\x01\x00\x00"), cafData...), ErrMissingFmt, "data"},
+		{"truncated caf data", truncatedCaf, ErrTruncated, "data"},
+		{"truncated aiff data", truncatedAiff, ErrTruncated, "SSND"},
+		{"truncated aiff COMM", makeAiff("AIFF", aiffComm)[:20], ErrTruncated, "COMM"},
+		{"small aiff COMM", makeAiff("AIFF", makeAiffChunk("COMM", int16(2))), ErrChunkSize, "COMM"},
+		{"aiff without COMM", makeAiff("AIFF", makeAiffChunk("SSND", uint32(0), uint32(0), []int16{1, 2})), ErrMissingFmt, "SSND"},
+		{"small w64 chunk", append(makeW64Chunk(w64RiffGUID, waveGUID[:]), make([]byte, 24)...), ErrChunkSize, ""},
+	}
+
+	for _, test := range tests {
+		// plain readers too, which can't find out the input size upfront
+		for _, r := range []io.Reader{bytes.NewReader(test.data), io.MultiReader(bytes.NewReader(test.data))} {
+			_, err := Parse(r)
+			if !errors.Is(err, test.expected) {
+				t.Errorf("%s: expected %v, given %v", test.name, test.expected, err)
+				continue
+			}
+
+			var chunkErr *ChunkError
+			if test.chunk != "" && (!errors.As(err, &chunkErr) || chunkErr.ID != test.chunk) {
+				t.Errorf("%s: expected an error in the %q chunk, given %v", test.name, test.chunk, err)
+			}
+		}
+	}
+}
+
+func TestLenientParsing(t *testing.T) {
+	data := makeRiff(
+		makePCMFmt(),
+		makeChunk("smpl", uint32(0)),
+		makeChunk("data", []int16{1, 2, 3, 4, 5, 6}),
+	)
+	// the last frame is cut in the middle
+	data = data[:len(data)-3]
+
+	for _, r := range []io.Reader{bytes.NewReader(data), io.MultiReader(bytes.NewReader(data))} {
+		if _, err := Parse(r); err == nil {
+			t.Fatalf("expected an error without the lenient option")
+		}
+	}
+
+	for _, r := range []io.Reader{bytes.NewReader(data), io.MultiReader(bytes.NewReader(data))} {
+		wav, err := ParseWithOptions(r, Options{Lenient: true})
+		if err != nil {
+			t.Fatalf("failed parsing: %v", err)
+		}
+		if err := wav.CheckFormat(); err != nil {
+			t.Fatalf("validation failed: %v", err)
+		}
+
+		if wav.GetNumSamples() != 2 || len(wav.Data[0]) != 2 {
+			t.Errorf("expected the 2 whole frames, given %d, with %d samples", wav.GetNumSamples(), len(wav.Data[0]))
+		}
+		if wav.Data[1][1] != 4.0/32768 {
+			t.Errorf("unexpected sample %v", wav.Data[1][1])
+		}
+
+		// the smpl chunk is too small, and the data chunk is truncated
+		if len(wav.Problems) != 2 || !errors.Is(wav.Problems[0], ErrChunkSize) || !errors.Is(wav.Problems[1], ErrTruncated) {
+			t.Errorf("unexpected problems: %v", wav.Problems)
+		}
+	}
+
+	// the same for AIFF
+	aiff := makeAiff("AIFF",
+		makeAiffChunk("COMM", int16(2), uint32(3), int16(16), extended44100),
+		makeAiffChunk("SSND", uint32(0), uint32(0), []int16{1, 2, 3, 4, 5, 6}),
+	)
+	aiff = aiff[:len(aiff)-3]
+
+	wav, err := ParseWithOptions(bytes.NewReader(aiff), Options{Lenient: true})
+	if err != nil {
+		t.Fatalf("failed parsing the AIFF file: %v", err)
+	}
+	if wav.GetNumSamples() != 2 || len(wav.Data[0]) != 2 {
+		t.Errorf("expected the 2 whole frames of the AIFF file, given %d, with %d samples", wav.GetNumSamples(), len(wav.Data[0]))
+	}
+	if len(wav.Problems) != 1 || !errors.Is(wav.Problems[0], ErrTruncated) {
+		t.Errorf("unexpected problems with the AIFF file: %v", wav.Problems)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	files, err := filepath.Glob("../test-files/*.wav")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		// the headers and a few frames are enough to start from
+		if len(data) > 1024 {
+			data = data[:1024]
+		}
+		f.Add(data)
+	}
+	f.Add(makeRiff(makePCMFmt(), makeChunk("LIST", []byte("INFOINAM\x03\x00\x00\x00abc\x00")), makeChunk("data", []int16{1, 2})))
+	f.Add([]byte("FORM0000AIFCCOMM\x00\x00\x00\x12\x00\x010000\x00 0000000000SSND000000 00000"))
+	f.Add(makeRiffInOrder(binary.BigEndian, makeChunkInOrder(binary.BigEndian, "fmt ", FormatPCM, int16(1), int32(8000), int32(16000), int16(2), int16(16)), makeChunkInOrder(binary.BigEndian, "data", []int16{1, 2})))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		wav, err := Parse(bytes.NewReader(data))
+
+		lenient, lenientErr := ParseWithOptions(bytes.NewReader(data), Options{Lenient: true})
+		if err == nil {
+			// whatever can be read can be read leniently too
+			if lenientErr != nil {
+				t.Fatalf("lenient parsing of a valid file failed: %v", lenientErr)
+			}
+			if lenient.GetNumSamples() != wav.GetNumSamples() {
+				t.Fatalf("expected %d samples, given %d", wav.GetNumSamples(), lenient.GetNumSamples())
+			}
+		}
+
+		if _, err := ParseHeader(bytes.NewReader(data)); err != nil && wav != nil {
+			t.Fatalf("failed parsing the header of a valid file: %v", err)
+		}
+	})
+}
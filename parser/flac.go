@@ -0,0 +1,711 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FlacStreamInfo holds the STREAMINFO fields of a FLAC stream that have no
+// WAVE counterpart.
+type FlacStreamInfo struct {
+	MinBlockSize uint16
+	MaxBlockSize uint16
+	MinFrameSize uint32
+	MaxFrameSize uint32
+	MD5          [16]byte // signature of the unencoded audio, all zeros if unknown
+
+	// whether the decoded audio was checked against MD5, which ParseHeader
+	// doesn't do, and whether it matches
+	MD5Checked bool
+	MD5Match   bool
+}
+
+// HasMD5 reports whether the encoder stored a signature of the audio.
+func (f *FlacStreamInfo) HasMD5() bool {
+	return f.MD5 != [16]byte{}
+}
+
+// vorbisCommentKeys maps the Vorbis comment field names to the keys used in
+// Wav.Metadata; the other names are lowercased.
+var vorbisCommentKeys = map[string]string{
+	"tracknumber": "track",
+	"description": "comment",
+	"encoder":     "software",
+}
+
+var flacFixedCoefficients = [5][]int64{
+	{},
+	{1},
+	{2, -1},
+	{3, -3, 1},
+	{4, -6, 4, -1},
+}
+
+var flacSampleSizes = [8]int16{0, 8, 12, 0, 16, 20, 24, 32}
+
+// flac channel assignments for stereo decorrelation; lower values hold the
+// number of independent channels minus one
+const (
+	flacLeftSide  = 8
+	flacSideRight = 9
+	flacMidSide   = 10
+)
+
+// flacCRC8Table and flacCRC16Table hold the CRC of each byte for the
+// polynomials of the frame headers, x^8+x^2+x+1, and of the frames,
+// x^16+x^15+x^2+1.
+var flacCRC8Table, flacCRC16Table = makeFlacCRCTables()
+
+func makeFlacCRCTables() (crc8 [256]uint8, crc16 [256]uint16) {
+	for b := range crc8 {
+		c8, c16 := uint8(b), uint16(b)<<8
+		for i := 0; i < 8; i++ {
+			if c8&0x80 != 0 {
+				c8 = c8<<1 ^ 0x07
+			} else {
+				c8 <<= 1
+			}
+			if c16&0x8000 != 0 {
+				c16 = c16<<1 ^ 0x8005
+			} else {
+				c16 <<= 1
+			}
+		}
+		crc8[b], crc16[b] = c8, c16
+	}
+
+	return crc8, crc16
+}
+
+// flacCRCReader keeps the CRC-8 and the CRC-16 of the bytes read since the
+// start of the current frame.
+type flacCRCReader struct {
+	r     io.ByteReader
+	crc8  uint8
+	crc16 uint16
+}
+
+func (c *flacCRCReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.update(b)
+	}
+
+	return b, err
+}
+
+// reset starts the CRCs of a frame over, from the bytes given.
+func (c *flacCRCReader) reset(data ...byte) {
+	c.crc8, c.crc16 = 0, 0
+	for _, b := range data {
+		c.update(b)
+	}
+}
+
+func (c *flacCRCReader) update(b byte) {
+	c.crc8 = flacCRC8Table[c.crc8^b]
+	c.crc16 = c.crc16<<8 ^ flacCRC16Table[byte(c.crc16>>8)^b]
+}
+
+// parseFlac decodes a native FLAC stream into the same structure that WAVE
+// files are read into.
+func parseFlac(cr *chunkReader, wav *Wav, options Options) error {
+	if err := binary.Read(cr, binary.BigEndian, &wav.ChunkID); err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+
+	wav.AudioFormat = FormatFLAC
+	wav.ByteOrder = binary.LittleEndian
+	wav.Signed = true
+
+	for last := false; !last; {
+		var header uint32
+		if err := binary.Read(cr, binary.BigEndian, &header); err != nil {
+			return fmt.Errorf("parse error: %w", err)
+		}
+
+		last = header>>31 == 1
+		blockType := header >> 24 & 0x7F
+		size := int64(header & 0xFFFFFF)
+
+		var err error
+		switch blockType {
+		case 0:
+			err = parseStreamInfo(cr, wav, size)
+		case 4:
+			err = parseVorbisComment(cr, wav, size)
+		default:
+			err = cr.skip(size)
+		}
+		if err != nil {
+			return fmt.Errorf("parse error: %w", err)
+		}
+	}
+
+	if wav.Flac == nil {
+		return fmt.Errorf("parse error: missing STREAMINFO block")
+	}
+
+	wav.selectSpan(options)
+	if err := wav.selectChannel(options); err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+
+	// ParseHeader still decodes the frames when STREAMINFO doesn't give the
+	// number of samples
+	start := cr.offset
+	if options.HeaderOnly && wav.SampleLength > 0 {
+		if _, err := cr.skipToEnd(); err != nil {
+			return fmt.Errorf("parse error: %w", err)
+		}
+	} else if err := parseFlacFrames(cr, wav); err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+
+	wav.Subchunk2Size = cr.offset - start
+	wav.ChunkSize = cr.offset - 8
+	if wav.SampleLength > 0 {
+		// the average rate of the compressed stream
+		wav.ByteRate = int32(wav.Subchunk2Size * int64(wav.SampleRate) / wav.SampleLength)
+	}
+
+	return nil
+}
+
+func parseStreamInfo(r io.Reader, wav *Wav, size int64) error {
+	if size < 34 {
+		return fmt.Errorf("%w: STREAMINFO block of %d bytes", ErrChunkSize, size)
+	}
+
+	block, err := readChunk(r, size)
+	if err != nil {
+		return err
+	}
+
+	info := &FlacStreamInfo{
+		MinBlockSize: binary.BigEndian.Uint16(block[0:]),
+		MaxBlockSize: binary.BigEndian.Uint16(block[2:]),
+		MinFrameSize: uint32(block[4])<<16 | uint32(block[5])<<8 | uint32(block[6]),
+		MaxFrameSize: uint32(block[7])<<16 | uint32(block[8])<<8 | uint32(block[9]),
+	}
+	copy(info.MD5[:], block[18:34])
+
+	// 20 bits of sample rate, 3 of channels, 5 of sample size and 36 of
+	// total samples
+	packed := binary.BigEndian.Uint64(block[10:])
+	wav.SampleRate = int32(packed >> 44)
+	wav.NumChannels = int16(packed>>41&0x7) + 1
+	wav.BitsPerSample = int16(packed>>36&0x1F) + 1
+	wav.SampleLength = int64(packed & (1<<36 - 1))
+
+	wav.BlockAlign = wav.NumChannels * ((wav.BitsPerSample + 7) / 8)
+	wav.ByteRate = wav.SampleRate * int32(wav.BlockAlign)
+	wav.Flac = info
+
+	return nil
+}
+
+// parseVorbisComment reads the tags of a VORBIS_COMMENT block; unlike the
+// rest of the stream, its lengths are little-endian.
+func parseVorbisComment(r io.Reader, wav *Wav, size int64) error {
+	block, err := readChunk(r, size)
+	if err != nil {
+		return err
+	}
+
+	br := bytes.NewReader(block)
+	readString := func() (string, error) {
+		var length uint32
+		if err := binary.Read(br, binary.LittleEndian, &length); err != nil {
+			return "", err
+		}
+		if int64(length) > int64(br.Len()) {
+			return "", fmt.Errorf("invalid vorbis comment length %d", length)
+		}
+
+		s := make([]byte, length)
+		_, err := io.ReadFull(br, s)
+
+		return string(s), err
+	}
+
+	// the vendor string names the encoder
+	vendor, err := readString()
+	if err != nil {
+		return err
+	}
+
+	var count uint32
+	if err := binary.Read(br, binary.LittleEndian, &count); err != nil {
+		return err
+	}
+
+	for i := uint32(0); i < count; i++ {
+		comment, err := readString()
+		if err != nil {
+			return err
+		}
+
+		name, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+
+		key := strings.ToLower(name)
+		if k, ok := vorbisCommentKeys[key]; ok {
+			key = k
+		}
+
+		// fields can be repeated, e.g. for multiple artists
+		if prev, ok := wav.Metadata[key]; ok {
+			value = prev + "; " + value
+		}
+		wav.setMetadata(key, value)
+	}
+
+	if _, ok := wav.Metadata["software"]; !ok {
+		wav.setMetadata("software", vendor)
+	}
+
+	return nil
+}
+
+func parseFlacFrames(cr *chunkReader, wav *Wav) error {
+	wav.Data = make([][]float32, wav.NumChannels)
+
+	crc := &flacCRCReader{r: cr}
+	br := newBitReader(crc)
+	hash := md5.New()
+	var raw []byte
+
+	var decoded int64
+	end := int64(-1)
+	if wav.SampleLength > 0 {
+		end = wav.SampleLength
+	}
+
+	for {
+		blockSize, channelAssignment, bps, err := readFlacFrameHeader(br, crc, wav)
+		if err == io.EOF {
+			// frames can only be missing when STREAMINFO doesn't say how
+			// many samples there are
+			if wav.SampleLength > 0 && decoded < wav.SampleLength {
+				return fmt.Errorf("%w: %d of the %d samples", ErrTruncated, decoded, wav.SampleLength)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		numChannels := int(channelAssignment) + 1
+		if channelAssignment >= flacLeftSide {
+			numChannels = 2
+		}
+		if numChannels != int(wav.NumChannels) {
+			return fmt.Errorf("frame has %d channels instead of %d", numChannels, wav.NumChannels)
+		}
+
+		samples := make([][]int64, numChannels)
+		for ch := range samples {
+			// the side channel needs an extra bit
+			size := bps
+			if (channelAssignment == flacLeftSide || channelAssignment == flacMidSide) && ch == 1 ||
+				channelAssignment == flacSideRight && ch == 0 {
+				size++
+			}
+
+			samples[ch], err = decodeFlacSubframe(br, blockSize, size)
+			if err != nil {
+				return truncated(err)
+			}
+		}
+
+		decorrelateFlacChannels(samples, channelAssignment)
+
+		normalized := make([][]float32, numChannels)
+		for ch := range normalized {
+			normalized[ch] = make([]float32, blockSize)
+		}
+
+		// the frame ends with padding to a whole byte and a CRC-16 of all
+		// of it
+		br.align()
+		expected := crc.crc16
+		if stored, err := br.readBits(16); err != nil {
+			return truncated(err)
+		} else if uint16(stored) != expected {
+			return fmt.Errorf("frame at sample %d fails its CRC-16: 0x%04x instead of 0x%04x", decoded, stored, expected)
+		}
+
+		// the MD5 is computed over the interleaved samples, stored
+		// little-endian in as many bytes as needed
+		sampleBytes := (int(bps) + 7) / 8
+		raw = raw[:0]
+		scale := float32(int64(1) << (bps - 1))
+		for i := 0; i < blockSize; i++ {
+			for ch, s := range samples {
+				for b := 0; b < sampleBytes; b++ {
+					raw = append(raw, byte(s[i]>>(8*b)))
+				}
+				normalized[ch][i] = float32(s[i]) / scale
+			}
+		}
+		hash.Write(raw)
+
+		// samples beyond the length in STREAMINFO are dropped
+		wav.appendSamples(trimSamples(normalized, decoded, 0, end))
+		decoded += int64(blockSize)
+
+		// frames can't be told apart without decoding them, so those before
+		// the span are decoded too, but the ones after it can be left out
+		// when STREAMINFO gives the length, leaving the MD5 unchecked
+		if wav.spanDone() && wav.SampleLength > 0 {
+			_, err := cr.skipToEnd()
+			return err
+		}
+	}
+
+	if wav.SampleLength == 0 {
+		wav.SampleLength = decoded
+	}
+
+	wav.Flac.MD5Checked = true
+	wav.Flac.MD5Match = bytes.Equal(hash.Sum(nil), wav.Flac.MD5[:])
+
+	return nil
+}
+
+// readFlacFrameHeader finds the next frame and reads its header, returning
+// io.EOF if the stream ends before another frame starts, and ErrTruncated
+// if it ends in the middle of the header. crc is what br reads from, and is
+// reset at the start of the frame.
+func readFlacFrameHeader(br *bitReader, crc *flacCRCReader, wav *Wav) (blockSize int, channelAssignment uint64, bps uint, err error) {
+	// frames start with a 14-bit sync code, followed by a reserved bit and
+	// the blocking strategy; anything else before them (e.g. an ID3v1 tag
+	// at the end) is skipped
+	var prev uint64
+	for {
+		b, err := br.readBits(8)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if prev == 0xFF && b&0xFE == 0xF8 {
+			crc.reset(byte(prev), byte(b))
+			break
+		}
+		prev = b
+	}
+
+	blockSize, channelAssignment, bps, err = readFlacFrameFields(br, crc, wav)
+	if err != nil {
+		return 0, 0, 0, truncated(err)
+	}
+
+	return blockSize, channelAssignment, bps, nil
+}
+
+// readFlacFrameFields reads the header of a frame past its sync code,
+// checking it against its CRC-8.
+func readFlacFrameFields(br *bitReader, crc *flacCRCReader, wav *Wav) (blockSize int, channelAssignment uint64, bps uint, err error) {
+	fields, err := br.readBits(16)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	blockSizeCode := fields >> 12
+	sampleRateCode := fields >> 8 & 0xF
+	channelAssignment = fields >> 4 & 0xF
+	sampleSizeCode := fields >> 1 & 0x7
+
+	if channelAssignment > flacMidSide {
+		return 0, 0, 0, fmt.Errorf("reserved channel assignment %d", channelAssignment)
+	}
+
+	bps = uint(wav.BitsPerSample)
+	if sampleSizeCode != 0 {
+		if flacSampleSizes[sampleSizeCode] == 0 {
+			return 0, 0, 0, fmt.Errorf("reserved sample size code %d", sampleSizeCode)
+		}
+		bps = uint(flacSampleSizes[sampleSizeCode])
+	}
+
+	// the frame or sample number, coded like UTF-8 on up to 7 bytes
+	first, err := br.readBits(8)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for mask := uint64(0x80); first&mask != 0 && mask > 1; mask >>= 1 {
+		if mask != 0x80 {
+			if _, err := br.readBits(8); err != nil {
+				return 0, 0, 0, err
+			}
+		}
+	}
+
+	switch {
+	case blockSizeCode == 0:
+		return 0, 0, 0, fmt.Errorf("reserved block size code")
+	case blockSizeCode == 1:
+		blockSize = 192
+	case blockSizeCode <= 5:
+		blockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 6:
+		v, err := br.readBits(8)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		blockSize = int(v) + 1
+	case blockSizeCode == 7:
+		v, err := br.readBits(16)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		blockSize = int(v) + 1
+	default:
+		blockSize = 256 << (blockSizeCode - 8)
+	}
+
+	// the sample rate is only stored in the frame when STREAMINFO has it
+	// too, so it's only read to get past it
+	switch sampleRateCode {
+	case 12:
+		_, err = br.readBits(8)
+	case 13, 14:
+		_, err = br.readBits(16)
+	case 15:
+		err = fmt.Errorf("invalid sample rate code")
+	}
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	// CRC-8 of the header
+	expected := crc.crc8
+	if stored, err := br.readBits(8); err != nil {
+		return 0, 0, 0, err
+	} else if uint8(stored) != expected {
+		return 0, 0, 0, fmt.Errorf("frame header fails its CRC-8: 0x%02x instead of 0x%02x", stored, expected)
+	}
+
+	return blockSize, channelAssignment, bps, nil
+}
+
+func decodeFlacSubframe(br *bitReader, blockSize int, bps uint) ([]int64, error) {
+	header, err := br.readBits(8)
+	if err != nil {
+		return nil, err
+	}
+	if header&0x80 != 0 {
+		return nil, fmt.Errorf("invalid subframe padding")
+	}
+	subframeType := header >> 1 & 0x3F
+
+	// wasted bits are the low zero bits shared by all the samples, which
+	// aren't coded
+	var wasted uint
+	if header&1 == 1 {
+		k, err := br.readUnary()
+		if err != nil {
+			return nil, err
+		}
+		wasted = uint(k) + 1
+		if wasted >= bps {
+			return nil, fmt.Errorf("invalid number of wasted bits %d", wasted)
+		}
+		bps -= wasted
+	}
+
+	samples := make([]int64, blockSize)
+
+	switch {
+	case subframeType == 0:
+		v, err := br.readSignedBits(bps)
+		if err != nil {
+			return nil, err
+		}
+		for i := range samples {
+			samples[i] = v
+		}
+	case subframeType == 1:
+		for i := range samples {
+			if samples[i], err = br.readSignedBits(bps); err != nil {
+				return nil, err
+			}
+		}
+	case subframeType >= 8 && subframeType <= 12:
+		if err := decodeFlacPredicted(br, samples, bps, int(subframeType-8), false); err != nil {
+			return nil, err
+		}
+	case subframeType >= 32:
+		if err := decodeFlacPredicted(br, samples, bps, int(subframeType-31), true); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("reserved subframe type %d", subframeType)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+
+	return samples, nil
+}
+
+// decodeFlacPredicted decodes a fixed or LPC subframe: the warm-up samples,
+// the LPC coefficients if any, and the residuals.
+func decodeFlacPredicted(br *bitReader, samples []int64, bps uint, order int, lpc bool) error {
+	if order > len(samples) {
+		return fmt.Errorf("predictor order %d larger than block size %d", order, len(samples))
+	}
+
+	for i := 0; i < order; i++ {
+		v, err := br.readSignedBits(bps)
+		if err != nil {
+			return err
+		}
+		samples[i] = v
+	}
+
+	var coefficients []int64
+	var shift int64
+	if !lpc {
+		coefficients = flacFixedCoefficients[order]
+	} else {
+		precision, err := br.readBits(4)
+		if err != nil {
+			return err
+		}
+		if precision == 0xF {
+			return fmt.Errorf("invalid LPC coefficient precision")
+		}
+		if shift, err = br.readSignedBits(5); err != nil {
+			return err
+		}
+		if shift < 0 {
+			return fmt.Errorf("negative LPC shift %d", shift)
+		}
+
+		coefficients = make([]int64, order)
+		for i := range coefficients {
+			if coefficients[i], err = br.readSignedBits(uint(precision) + 1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := decodeFlacResidual(br, samples, order); err != nil {
+		return err
+	}
+
+	predict(samples, coefficients, uint(shift))
+
+	return nil
+}
+
+// predict adds the prediction from the previous samples to the residuals
+// stored in samples, after the warm-up samples.
+func predict(samples []int64, coefficients []int64, shift uint) {
+	order := len(coefficients)
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, c := range coefficients {
+			sum += c * samples[i-1-j]
+		}
+		samples[i] += sum >> shift
+	}
+}
+
+// decodeFlacResidual reads the Rice coded residuals into samples, after the
+// order warm-up samples.
+func decodeFlacResidual(br *bitReader, samples []int64, order int) error {
+	method, err := br.readBits(2)
+	if err != nil {
+		return err
+	}
+	if method > 1 {
+		return fmt.Errorf("reserved residual coding method %d", method)
+	}
+
+	// the second method has 5-bit parameters, for higher resolutions; the
+	// largest value escapes to unencoded residuals
+	paramSize := uint(4 + method)
+	escape := uint64(1)<<paramSize - 1
+
+	partitionOrder, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+
+	partitionSize := len(samples) >> partitionOrder
+	if partitionSize<<partitionOrder != len(samples) || partitionSize < order {
+		return fmt.Errorf("invalid partition order %d for block size %d", partitionOrder, len(samples))
+	}
+
+	i := order
+	for p := 0; p < 1<<partitionOrder; p++ {
+		n := partitionSize
+		if p == 0 {
+			n -= order
+		}
+
+		param, err := br.readBits(paramSize)
+		if err != nil {
+			return err
+		}
+
+		if param == escape {
+			size, err := br.readBits(5)
+			if err != nil {
+				return err
+			}
+			for end := i + n; i < end; i++ {
+				if samples[i], err = br.readSignedBits(uint(size)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		for end := i + n; i < end; i++ {
+			q, err := br.readUnary()
+			if err != nil {
+				return err
+			}
+			r, err := br.readBits(uint(param))
+			if err != nil {
+				return err
+			}
+
+			// zigzag coded: 0, -1, 1, -2, 2...
+			v := q<<param | r
+			samples[i] = int64(v>>1) ^ -int64(v&1)
+		}
+	}
+
+	return nil
+}
+
+func decorrelateFlacChannels(samples [][]int64, channelAssignment uint64) {
+	switch channelAssignment {
+	case flacLeftSide:
+		for i, side := range samples[1] {
+			samples[1][i] = samples[0][i] - side
+		}
+	case flacSideRight:
+		for i, side := range samples[0] {
+			samples[0][i] = side + samples[1][i]
+		}
+	case flacMidSide:
+		for i, side := range samples[1] {
+			mid := samples[0][i]<<1 | side&1
+			samples[0][i] = (mid + side) >> 1
+			samples[1][i] = (mid - side) >> 1
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// bitWriter builds the bit fields of FLAC frames, most significant bit first.
+type bitWriter struct {
+	buf   []byte
+	n     uint // number of bits used in the last byte
+	frame int  // where the last frame starts in buf
+}
+
+func (bw *bitWriter) write(v int64, size uint) {
+	for i := int(size) - 1; i >= 0; i-- {
+		if bw.n%8 == 0 {
+			bw.buf = append(bw.buf, 0)
+			bw.n = 0
+		}
+		bw.buf[len(bw.buf)-1] |= byte(v>>i&1) << (7 - bw.n)
+		bw.n++
+	}
+}
+
+func (bw *bitWriter) writeRice(v int64, param uint) {
+	zigzag := v << 1
+	if v < 0 {
+		zigzag = -v<<1 - 1
+	}
+	bw.write(1, uint(zigzag>>param)+1)
+	bw.write(zigzag, param)
+}
+
+// writeFrameHeader writes the header of a frame with an 8-bit block size.
+func (bw *bitWriter) writeFrameHeader(number, blockSize, channelAssignment int64) {
+	bw.frame = len(bw.buf)
+	bw.write(0xFFF8, 16)
+	bw.write(6, 4) // block size in the header
+	bw.write(0, 4) // sample rate from STREAMINFO
+	bw.write(channelAssignment, 4)
+	bw.write(4, 3) // 16-bit
+	bw.write(0, 1)
+	bw.write(number, 8)
+	bw.write(blockSize-1, 8)
+	bw.write(int64(bw.crc().crc8), 8)
+}
+
+func (bw *bitWriter) writeFrameFooter() {
+	bw.n = 0
+	bw.write(int64(bw.crc().crc16), 16)
+}
+
+// crc returns the CRCs of the last frame so far.
+func (bw *bitWriter) crc() *flacCRCReader {
+	var crc flacCRCReader
+	crc.reset(bw.buf[bw.frame:]...)
+
+	return &crc
+}
+
+func TestDecodingFlac(t *testing.T) {
+	left := []int64{100, 110, 120, 125, -200, -200, -100, 0, 7}
+	right := []int64{90, 100, 130, 125, -200, -200, -300, -100, -7}
+
+	var frames bitWriter
+
+	// left/side, with a fixed order 1 left channel and a verbatim side channel
+	frames.writeFrameHeader(0, 4, flacLeftSide)
+	frames.write((8+1)<<1, 8)
+	frames.write(100, 16)
+	frames.write(0, 2)
+	frames.write(0, 4)
+	frames.write(2, 4)
+	for _, r := range []int64{10, 10, 5} {
+		frames.writeRice(r, 2)
+	}
+	frames.write(1<<1, 8)
+	for _, s := range []int64{10, 10, -10, 0} {
+		frames.write(s, 17)
+	}
+	frames.writeFrameFooter()
+
+	// mid/side, with an order 1 LPC mid channel using an escaped partition,
+	// and a verbatim side channel
+	frames.writeFrameHeader(1, 4, flacMidSide)
+	frames.write(32<<1, 8)
+	frames.write(-200, 16)
+	frames.write(3, 4)  // 4-bit coefficients
+	frames.write(0, 5)  // no shift
+	frames.write(1, 4)  // a single coefficient of 1
+	frames.write(1, 2)  // 5-bit Rice parameters
+	frames.write(0, 4)  // a single partition
+	frames.write(31, 5) // escaped
+	frames.write(9, 5)
+	for _, r := range []int64{0, 0, 150} {
+		frames.write(r, 9)
+	}
+	frames.write(1<<1, 8)
+	for _, s := range []int64{0, 0, 200, 100} {
+		frames.write(s, 17)
+	}
+	frames.writeFrameFooter()
+
+	// independent channels, both constant
+	frames.writeFrameHeader(2, 1, 1)
+	frames.write(0, 8)
+	frames.write(7, 16)
+	frames.write(0, 8)
+	frames.write(-7, 16)
+	frames.writeFrameFooter()
+
+	hash := md5.New()
+	for i := range left {
+		_ = binary.Write(hash, binary.LittleEndian, []int16{int16(left[i]), int16(right[i])})
+	}
+
+	var streamInfo bytes.Buffer
+	_ = binary.Write(&streamInfo, binary.BigEndian, []uint16{4, 4})
+	streamInfo.Write(make([]byte, 6))
+	_ = binary.Write(&streamInfo, binary.BigEndian, uint64(8000)<<44|1<<41|15<<36|uint64(len(left)))
+	streamInfo.Write(hash.Sum(nil))
+
+	var comments bytes.Buffer
+	_ = binary.Write(&comments, binary.LittleEndian, uint32(4))
+	comments.WriteString("test")
+	_ = binary.Write(&comments, binary.LittleEndian, uint32(2))
+	for _, c := range []string{"TITLE=Sine", "tracknumber=2"} {
+		_ = binary.Write(&comments, binary.LittleEndian, uint32(len(c)))
+		comments.WriteString(c)
+	}
+
+	var stream bytes.Buffer
+	stream.WriteString("fLaC")
+	_ = binary.Write(&stream, binary.BigEndian, uint32(streamInfo.Len()))
+	stream.Write(streamInfo.Bytes())
+	_ = binary.Write(&stream, binary.BigEndian, uint32(1<<31|4<<24|comments.Len()))
+	stream.Write(comments.Bytes())
+	stream.Write(frames.buf)
+
+	wav, err := Parse(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	if err := wav.CheckFormat(); err != nil {
+		t.Fatalf("validation failed: %v", err)
+	}
+
+	if wav.SampleRate != 8000 || wav.NumChannels != 2 || wav.BitsPerSample != 16 {
+		t.Errorf("unexpected format: %d Hz, %d channels, %d-bit", wav.SampleRate, wav.NumChannels, wav.BitsPerSample)
+	}
+	if n := wav.GetNumSamples(); n != int64(len(left)) {
+		t.Errorf("expected %d samples, got %d", len(left), n)
+	}
+	if !wav.Flac.MD5Match {
+		t.Errorf("the decoded audio doesn't match the MD5")
+	}
+
+	for ch, expected := range [][]int64{left, right} {
+		for i, s := range expected {
+			if got := wav.Data[ch][i] * (1 << 15); got != float32(s) {
+				t.Errorf("channel %d, sample %d: expected %d, got %v", ch, i, s, got)
+			}
+		}
+	}
+
+	if wav.Metadata["title"] != "Sine" || wav.Metadata["track"] != "2" || wav.Metadata["software"] != "test" {
+		t.Errorf("unexpected metadata: %v", wav.Metadata)
+	}
+
+	header, err := ParseHeader(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("failed parsing the header: %v", err)
+	}
+	if header.GetNumSamples() != wav.GetNumSamples() || header.Subchunk2Size != wav.Subchunk2Size || header.Data != nil {
+		t.Errorf("expected the header to match the decoded stream")
+	}
+	if header.Flac.MD5Checked {
+		t.Errorf("expected the MD5 not to be checked")
+	}
+
+	// a stream cut short, in the middle of a frame or of its header, or
+	// between two frames, as STREAMINFO gives its length
+	frameSize := len(frames.buf) - frames.frame
+	for _, cut := range []int{1, 3, frameSize} {
+		data := stream.Bytes()[:stream.Len()-cut]
+		if _, err := Parse(bytes.NewReader(data)); !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected a truncated stream with %d bytes missing, given %v", cut, err)
+		}
+	}
+
+	// a damaged sample, and a damaged header
+	for _, offset := range []int{frames.frame + 8, frames.frame + 4} {
+		data := append([]byte(nil), stream.Bytes()...)
+		data[stream.Len()-len(frames.buf)+offset] ^= 0x10
+		if _, err := Parse(bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "CRC") {
+			t.Errorf("expected a CRC error with byte %d of the frames damaged, given %v", offset, err)
+		}
+	}
+}
+
+func TestFlacCRCs(t *testing.T) {
+	var crc flacCRCReader
+	crc.reset([]byte("123456789")...)
+	if crc.crc8 != 0xF4 || crc.crc16 != 0xFEE8 {
+		t.Errorf("expected the check values 0xf4 and 0xfee8, given 0x%02x and 0x%04x", crc.crc8, crc.crc16)
+	}
+}
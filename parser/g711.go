@@ -0,0 +1,41 @@
+package parser
+
+// G.711 companding, as described in ITU-T G.711 and implemented by the
+// reference g711.c; both decoders return 16-bit linear PCM.
+
+func alawToLinear(a uint8) int16 {
+	a ^= 0x55
+
+	t := int16(a&0x0f) << 4
+	segment := (a & 0x70) >> 4
+	switch segment {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= segment - 1
+	}
+
+	if a&0x80 != 0 {
+		return t
+	}
+
+	return -t
+}
+
+func mulawToLinear(u uint8) int16 {
+	const bias = 0x84
+
+	u = ^u
+
+	t := (int16(u&0x0f) << 3) + bias
+	t <<= (u & 0x70) >> 4
+
+	if u&0x80 != 0 {
+		return bias - t
+	}
+
+	return t - bias
+}
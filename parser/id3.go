@@ -0,0 +1,318 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// id3Keys maps the ID3v2 frame IDs to the keys used in Wav.Metadata; the
+// other text frames are kept under their IDs.
+var id3Keys = map[string]string{
+	"TIT2": "title",
+	"TPE1": "artist",
+	"TALB": "album",
+	"TRCK": "track",
+	"TCON": "genre",
+	"TYER": "date",
+	"TDRC": "date",
+	"TSSE": "software",
+	"TCOP": "copyright",
+	"TIT3": "subject",
+	"COMM": "comment",
+
+	// ID3v2.2 uses three-character IDs
+	"TT2": "title",
+	"TP1": "artist",
+	"TAL": "album",
+	"TRK": "track",
+	"TCO": "genre",
+	"TYE": "date",
+	"TSS": "software",
+	"TCR": "copyright",
+	"TT3": "subject",
+	"COM": "comment",
+}
+
+// parseID3 reads an ID3v2 tag, starting at its "ID3" header, into the
+// metadata and the pictures; frames that can't be read are skipped.
+func parseID3(r io.Reader, wav *Wav) error {
+	var header struct {
+		ID      [3]byte
+		Version [2]byte
+		Flags   byte
+		Size    [4]byte
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	if string(header.ID[:]) != "ID3" {
+		return fmt.Errorf("invalid ID3 header")
+	}
+
+	size := syncsafe(header.Size[:])
+	if header.Flags&0x10 != 0 {
+		// a copy of the header follows the tag in ID3v2.4
+		size += 10
+	}
+
+	tag, err := readChunk(r, int64(size))
+	if err != nil {
+		return err
+	}
+
+	version := header.Version[0]
+	if version < 2 || version > 4 {
+		// the structure of unknown versions can't be relied upon
+		return nil
+	}
+
+	// before ID3v2.4, unsynchronisation applies to the whole tag
+	if header.Flags&0x80 != 0 && version < 4 {
+		tag = removeUnsynchronisation(tag)
+	}
+
+	if header.Flags&0x40 != 0 && version > 2 && len(tag) >= 4 {
+		// the extended header doesn't include its size field in ID3v2.3
+		extended := int(binary.BigEndian.Uint32(tag)) + 4
+		if version == 4 {
+			extended = syncsafe(tag[:4])
+		}
+		if extended > len(tag) {
+			return nil
+		}
+		tag = tag[extended:]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+
+	for len(tag) >= headerSize && tag[0] != 0 {
+		id := string(tag[:idSize])
+
+		var frameSize int
+		var flags uint16
+		switch version {
+		case 2:
+			frameSize = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(tag[4:]))
+			flags = binary.BigEndian.Uint16(tag[8:])
+		case 4:
+			frameSize = syncsafe(tag[4:8])
+			flags = binary.BigEndian.Uint16(tag[8:])
+		}
+
+		if frameSize < 0 || frameSize > len(tag)-headerSize {
+			break
+		}
+		frame := tag[headerSize : headerSize+frameSize]
+		tag = tag[headerSize+frameSize:]
+
+		frame, ok := decodeID3FrameFlags(frame, version, flags)
+		if !ok {
+			continue
+		}
+
+		parseID3Frame(wav, id, frame)
+	}
+
+	return nil
+}
+
+// parseID3Chunk reads the ID3v2 tag that some editors store in an "id3 " or
+// "ID3 " chunk of WAVE and AIFF files.
+func parseID3Chunk(r io.Reader, wav *Wav, chunkSize int64) error {
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	return parseID3(bytes.NewReader(chunk), wav)
+}
+
+// decodeID3FrameFlags undoes what the frame flags describe, reporting false
+// for the frames that can't be read, like compressed or encrypted ones.
+func decodeID3FrameFlags(frame []byte, version byte, flags uint16) ([]byte, bool) {
+	switch version {
+	case 3:
+		if flags&0x00C0 != 0 {
+			return nil, false
+		}
+		if flags&0x0020 != 0 && len(frame) > 0 {
+			// the group identifier
+			frame = frame[1:]
+		}
+	case 4:
+		if flags&0x000C != 0 {
+			return nil, false
+		}
+		if flags&0x0040 != 0 && len(frame) > 0 {
+			frame = frame[1:]
+		}
+		if flags&0x0002 != 0 {
+			frame = removeUnsynchronisation(frame)
+		}
+		if flags&0x0001 != 0 && len(frame) >= 4 {
+			// the data length indicator
+			frame = frame[4:]
+		}
+	}
+
+	return frame, true
+}
+
+func parseID3Frame(wav *Wav, id string, frame []byte) {
+	if len(frame) == 0 {
+		return
+	}
+
+	key, ok := id3Keys[id]
+	if !ok {
+		key = id
+	}
+
+	switch {
+	case id == "TXXX" || id == "TXX":
+		// user defined text, keyed by its description
+		encoding := frame[0]
+		description, value := splitID3String(frame[1:], encoding)
+		if name := decodeID3String(description, encoding); name != "" {
+			wav.setMetadata(strings.ToLower(name), decodeID3Text(value, encoding))
+		}
+	case id[0] == 'T':
+		wav.setMetadata(key, decodeID3Text(frame[1:], frame[0]))
+	case id == "COMM" || id == "COM":
+		// an encoding, a language and a short description come before
+		// the text
+		if len(frame) < 4 {
+			return
+		}
+		encoding := frame[0]
+		_, text := splitID3String(frame[4:], encoding)
+		wav.setMetadata(key, decodeID3String(text, encoding))
+	case id == "APIC" || id == "PIC":
+		parseID3Picture(wav, id, frame)
+	}
+}
+
+// parseID3Picture reads an attached picture; ID3v2.2 has a three-letter
+// image format where the later versions have a MIME type.
+func parseID3Picture(wav *Wav, id string, frame []byte) {
+	encoding := frame[0]
+
+	var format, rest []byte
+	if id == "PIC" {
+		if len(frame) < 4 {
+			return
+		}
+		format, rest = frame[1:4], frame[4:]
+	} else {
+		format, rest = splitID3String(frame[1:], 0)
+	}
+	if len(rest) == 0 {
+		return
+	}
+
+	description, data := splitID3String(rest[1:], encoding)
+	wav.Pictures = append(wav.Pictures, Picture{
+		Type:        rest[0],
+		MIMEType:    imageMIMEType(string(format)),
+		Description: decodeID3String(description, encoding),
+		Data:        data,
+	})
+}
+
+// splitID3String splits b after its first string, which is terminated by
+// one NUL character of the given encoding.
+func splitID3String(b []byte, encoding byte) ([]byte, []byte) {
+	if encoding == 1 || encoding == 2 {
+		// UTF-16 has two-byte NULs, aligned to the characters
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[:i], b[i+2:]
+			}
+		}
+
+		return b, nil
+	}
+
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+
+	return b, nil
+}
+
+// decodeID3Text decodes the strings of a text frame; ID3v2.4 allows several
+// of them, separated by NULs.
+func decodeID3Text(b []byte, encoding byte) string {
+	var values []string
+	for len(b) > 0 {
+		var s []byte
+		s, b = splitID3String(b, encoding)
+		if v := decodeID3String(s, encoding); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return strings.Join(values, "; ")
+}
+
+// decodeID3String converts a string in one of the ID3v2 encodings to UTF-8.
+func decodeID3String(b []byte, encoding byte) string {
+	switch encoding {
+	case 0:
+		// ISO-8859-1 maps directly onto the first Unicode code points
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	case 1, 2:
+		var byteOrder binary.ByteOrder = binary.BigEndian
+		if len(b) >= 2 && b[0] == 0xFF && b[1] == 0xFE {
+			byteOrder = binary.LittleEndian
+			b = b[2:]
+		} else if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+			b = b[2:]
+		}
+
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = byteOrder.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units))
+	default:
+		return string(b)
+	}
+}
+
+// syncsafe decodes an integer stored in the low 7 bits of each byte.
+func syncsafe(b []byte) int {
+	var v int
+	for _, c := range b {
+		v = v<<7 | int(c&0x7F)
+	}
+
+	return v
+}
+
+// removeUnsynchronisation drops the zero bytes inserted after 0xFF bytes to
+// prevent false MPEG frame syncs.
+func removeUnsynchronisation(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xFF && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+
+	return out
+}
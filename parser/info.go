@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// infoKeys maps the LIST/INFO chunk IDs to the keys used in Wav.Metadata;
+// unknown IDs are kept as they are.
+var infoKeys = map[string]string{
+	"INAM": "title",
+	"IART": "artist",
+	"IPRD": "album",
+	"ITRK": "track",
+	"IPRT": "track",
+	"IGNR": "genre",
+	"ICMT": "comment",
+	"ICRD": "date",
+	"ISFT": "software",
+	"IENG": "engineer",
+	"ITCH": "technician",
+	"ICOP": "copyright",
+	"IKEY": "keywords",
+	"ISBJ": "subject",
+	"ISRC": "source",
+}
+
+func (w *Wav) setMetadata(key, value string) {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	if value == "" {
+		return
+	}
+
+	if w.Metadata == nil {
+		w.Metadata = make(map[string]string)
+	}
+	w.Metadata[key] = value
+}
+
+// parseList reads a LIST chunk; only INFO and adtl lists are parsed, the
+// others are discarded.
+func parseList(r io.Reader, wav *Wav, chunkSize int64) error {
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	if len(chunk) < 4 {
+		return nil
+	}
+
+	switch string(chunk[:4]) {
+	case "INFO":
+		parseInfoList(wav, splitSubchunks(chunk[4:], wav.byteOrder()))
+	case "adtl":
+		parseAdtlList(wav, splitSubchunks(chunk[4:], wav.byteOrder()))
+	}
+
+	return nil
+}
+
+func parseInfoList(wav *Wav, subchunks []subchunk) {
+	for _, sub := range subchunks {
+		key, ok := infoKeys[sub.id]
+		if !ok {
+			key = sub.id
+		}
+
+		wav.setMetadata(key, string(sub.data))
+	}
+}
+
+type subchunk struct {
+	id   string
+	data []byte
+}
+
+// splitSubchunks splits the body of a LIST chunk into its subchunks, skipping
+// the pad bytes that follow the odd-sized ones.
+func splitSubchunks(list []byte, byteOrder binary.ByteOrder) []subchunk {
+	var subchunks []subchunk
+
+	for len(list) >= 8 {
+		id := string(list[:4])
+		size := int(byteOrder.Uint32(list[4:8]))
+		list = list[8:]
+
+		if size > len(list) {
+			size = len(list)
+		}
+		subchunks = append(subchunks, subchunk{id: id, data: list[:size]})
+
+		if size%2 == 1 && size < len(list) {
+			size++
+		}
+		list = list[size:]
+	}
+
+	return subchunks
+}
@@ -0,0 +1,226 @@
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// IXML holds the production metadata that location sound recorders store in
+// the iXML chunk.
+type IXML struct {
+	Project string
+	Scene   string
+	Take    string
+	Tape    string
+	Circled bool // the take was marked as a good one
+	Note    string
+
+	TimecodeRate string // frames per second, as a fraction, e.g. "30000/1001"
+	TimecodeFlag string // DF for drop frame, NDF otherwise
+
+	// the start of the recording, in samples since midnight at the
+	// given rate, the sample rate of the file if 0
+	TimestampSamples    uint64
+	TimestampSampleRate int
+
+	Tracks []IXMLTrack
+
+	XML string // the whole document
+}
+
+// IXMLTrack describes one of the channels of the file.
+type IXMLTrack struct {
+	ChannelIndex    int // of the recorder's input, from 1
+	InterleaveIndex int // of the channel in the file, from 1; its position in the list if missing
+	Name            string
+	Function        string // e.g. "M-MID_SIDE" or "L"
+}
+
+// GetFPS returns the timecode rate rounded to whole frames per second, which
+// is how the frames are counted, or 0 if it's missing.
+func (x *IXML) GetFPS() int {
+	numerator, denominator, ok := x.getRate()
+	if !ok {
+		return 0
+	}
+
+	return int(math.Round(float64(numerator) / float64(denominator)))
+}
+
+// getRate reads the timecode rate as a fraction, e.g. 30000/1001.
+func (x *IXML) getRate() (uint64, uint64, bool) {
+	numerator, denominator, found := strings.Cut(x.TimecodeRate, "/")
+	n, err := strconv.ParseUint(strings.TrimSpace(numerator), 10, 32)
+	if err != nil || n == 0 {
+		return 0, 0, false
+	}
+
+	d := uint64(1)
+	if found {
+		if d, err = strconv.ParseUint(strings.TrimSpace(denominator), 10, 32); err != nil || d == 0 {
+			return 0, 0, false
+		}
+	}
+
+	return n, d, true
+}
+
+// GetStartTimecode returns the timecode of the start of the recording, like
+// "01:00:00:00", or "01:00:00;00" for drop frame timecode, given the sample
+// rate of the file; it returns "" if the timestamp or the rate is missing.
+func (x *IXML) GetStartTimecode(sampleRate int) string {
+	rate := uint64(x.TimestampSampleRate)
+	if rate == 0 && sampleRate > 0 {
+		rate = uint64(sampleRate)
+	}
+	numerator, denominator, ok := x.getRate()
+	fps := uint64(x.GetFPS())
+	if x.TimestampSamples == 0 || rate == 0 || !ok || fps == 0 {
+		return ""
+	}
+
+	// the frames elapsed at the exact rate, like 29.97 frames per second,
+	// which are numbered at the nominal one, like 30 (the whole seconds and
+	// the rest are split so that long timestamps can't overflow)
+	elapsed := x.TimestampSamples / rate * numerator
+	frames := elapsed/denominator + (elapsed%denominator*rate+x.TimestampSamples%rate*numerator)/(rate*denominator)
+
+	separator := ":"
+	if dropFrame := fps / 15; strings.EqualFold(x.TimecodeFlag, "DF") && fps%30 == 0 {
+		// drop frame timecode skips the first frame numbers of every minute
+		// but each tenth one, to keep up with the clock
+		separator = ";"
+		perTenMinutes := fps*600 - dropFrame*9
+		perMinute := fps*60 - dropFrame
+		tens, rest := frames/perTenMinutes, frames%perTenMinutes
+		frames += dropFrame * 9 * tens
+		if rest > dropFrame {
+			frames += dropFrame * ((rest - dropFrame) / perMinute)
+		}
+	}
+
+	frames %= 24 * 3600 * fps
+	hours := frames / (3600 * fps)
+	minutes := frames / (60 * fps) % 60
+	secs := frames / fps % 60
+
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", hours, minutes, secs, separator, frames%fps)
+}
+
+// parseIXML reads the iXML chunk; documents that aren't valid XML are kept
+// as they are, without their fields.
+func parseIXML(r io.Reader, wav *Wav, chunkSize int64) error {
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	ixml := &IXML{XML: fixedString(chunk)}
+	wav.IXML = ixml
+
+	var doc struct {
+		Project string `xml:"PROJECT"`
+		Scene   string `xml:"SCENE"`
+		Take    string `xml:"TAKE"`
+		Tape    string `xml:"TAPE"`
+		Circled string `xml:"CIRCLED"`
+		Note    string `xml:"NOTE"`
+		Speed   struct {
+			TimecodeRate        string `xml:"TIMECODE_RATE"`
+			TimecodeFlag        string `xml:"TIMECODE_FLAG"`
+			TimestampHi         string `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI"`
+			TimestampLo         string `xml:"TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO"`
+			TimestampSampleRate string `xml:"TIMESTAMP_SAMPLE_RATE"`
+		} `xml:"SPEED"`
+		Tracks []struct {
+			ChannelIndex    string `xml:"CHANNEL_INDEX"`
+			InterleaveIndex string `xml:"INTERLEAVE_INDEX"`
+			Name            string `xml:"NAME"`
+			Function        string `xml:"FUNCTION"`
+		} `xml:"TRACK_LIST>TRACK"`
+	}
+	if err := xml.Unmarshal([]byte(ixml.XML), &doc); err != nil {
+		return nil
+	}
+
+	ixml.Project = strings.TrimSpace(doc.Project)
+	ixml.Scene = strings.TrimSpace(doc.Scene)
+	ixml.Take = strings.TrimSpace(doc.Take)
+	ixml.Tape = strings.TrimSpace(doc.Tape)
+	ixml.Circled = strings.EqualFold(strings.TrimSpace(doc.Circled), "true")
+	ixml.Note = strings.TrimSpace(doc.Note)
+	ixml.TimecodeRate = strings.TrimSpace(doc.Speed.TimecodeRate)
+	ixml.TimecodeFlag = strings.TrimSpace(doc.Speed.TimecodeFlag)
+	ixml.TimestampSamples = uint64(atoi(doc.Speed.TimestampHi))<<32 | uint64(uint32(atoi(doc.Speed.TimestampLo)))
+	ixml.TimestampSampleRate = atoi(doc.Speed.TimestampSampleRate)
+
+	for i, t := range doc.Tracks {
+		track := IXMLTrack{
+			ChannelIndex:    atoi(t.ChannelIndex),
+			InterleaveIndex: atoi(t.InterleaveIndex),
+			Name:            strings.TrimSpace(t.Name),
+			Function:        strings.TrimSpace(t.Function),
+		}
+		if track.InterleaveIndex == 0 {
+			track.InterleaveIndex = i + 1
+		}
+		ixml.Tracks = append(ixml.Tracks, track)
+	}
+
+	return nil
+}
+
+// parseAXML reads the axml chunk, which holds an EBU Core or ADM document
+// that is kept as it is.
+func parseAXML(r io.Reader, wav *Wav, chunkSize int64) error {
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	wav.AXML = fixedString(chunk)
+
+	return nil
+}
+
+// GetAXMLRoot returns the name of the root element of the axml document,
+// like "ebuCoreMain", or "" if there's none.
+func (w *Wav) GetAXMLRoot() string {
+	d := xml.NewDecoder(strings.NewReader(w.AXML))
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// GetChannelName returns the name of a channel, counted from 0, from the
+// iXML track list, or "" if it has none.
+func (w *Wav) GetChannelName(channel int) string {
+	if w.IXML == nil {
+		return ""
+	}
+
+	for _, t := range w.IXML.Tracks {
+		if t.InterleaveIndex == channel+1 {
+			return t.Name
+		}
+	}
+
+	return ""
+}
+
+// atoi parses the integers of XML elements, which are 0 when missing.
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+
+	return n
+}
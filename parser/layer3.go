@@ -0,0 +1,1268 @@
+package parser
+
+import (
+	"bytes"
+	"math"
+)
+
+// the Layer III decoder follows ISO/IEC 11172-3 and, for the lower sampling
+// frequencies of MPEG-2 and MPEG-2.5, ISO/IEC 13818-3
+
+const (
+	mp3Stereo = iota
+	mp3JointStereo
+	mp3DualChannel
+	mp3Mono
+)
+
+// mp3Header holds the fields of an MPEG audio frame header.
+type mp3Header struct {
+	version       string
+	lsf           bool // MPEG-2 and MPEG-2.5 low sampling frequencies
+	protected     bool // whether a CRC follows the header
+	bitrate       int  // in bits per second
+	sampleRate    int
+	padding       bool
+	mode          int
+	modeExtension int
+}
+
+var mp3Bitrates = [2][15]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// mp3SampleRates are indexed by the version bits of the header.
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},
+	{},
+	{22050, 24000, 16000},
+	{44100, 48000, 32000},
+}
+
+var mp3Versions = [4]string{"MPEG-2.5", "", "MPEG-2", "MPEG-1"}
+
+// parseMP3Header reads the 4-byte header of a Layer III frame, reporting
+// false if b isn't one; free format streams aren't supported.
+func parseMP3Header(b []byte) (mp3Header, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mp3Header{}, false
+	}
+
+	version := b[1] >> 3 & 0x3
+	layer := b[1] >> 1 & 0x3
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := b[2] >> 2 & 0x3
+	if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return mp3Header{}, false
+	}
+
+	h := mp3Header{
+		version:       mp3Versions[version],
+		lsf:           version != 3,
+		protected:     b[1]&1 == 0,
+		sampleRate:    mp3SampleRates[version][sampleRateIndex],
+		padding:       b[2]>>1&1 == 1,
+		mode:          int(b[3] >> 6),
+		modeExtension: int(b[3] >> 4 & 0x3),
+	}
+	if h.lsf {
+		h.bitrate = mp3Bitrates[1][bitrateIndex] * 1000
+	} else {
+		h.bitrate = mp3Bitrates[0][bitrateIndex] * 1000
+	}
+
+	return h, true
+}
+
+func (h mp3Header) channels() int {
+	if h.mode == mp3Mono {
+		return 1
+	}
+
+	return 2
+}
+
+func (h mp3Header) granules() int {
+	if h.lsf {
+		return 1
+	}
+
+	return 2
+}
+
+func (h mp3Header) samplesPerFrame() int {
+	return 576 * h.granules()
+}
+
+func (h mp3Header) frameSize() int {
+	size := 144 * h.bitrate / h.sampleRate
+	if h.lsf {
+		size = 72 * h.bitrate / h.sampleRate
+	}
+	if h.padding {
+		size++
+	}
+
+	return size
+}
+
+func (h mp3Header) sideInfoSize() int {
+	switch {
+	case h.lsf && h.channels() == 1:
+		return 9
+	case h.lsf:
+		return 17
+	case h.channels() == 1:
+		return 17
+	default:
+		return 32
+	}
+}
+
+// mp3Granule holds the side information of one channel of a granule.
+type mp3Granule struct {
+	part23Length     int
+	bigValues        int
+	globalGain       int
+	scalefacCompress int
+	blockType        int // 0 for normal, 1 for start, 2 for short and 3 for stop blocks
+	mixed            bool
+	tableSelect      [3]int
+	subblockGain     [3]int
+	region0Count     int
+	region1Count     int
+	preflag          bool
+	scalefacScale    int
+	count1Table      int
+}
+
+type mp3SideInfo struct {
+	mainDataBegin int
+	scfsi         [2][4]bool
+	granules      [2][2]mp3Granule // by granule and channel
+}
+
+func readMP3SideInfo(b []byte, h mp3Header) mp3SideInfo {
+	var si mp3SideInfo
+	br := newBitReader(bytes.NewReader(b))
+	channels := h.channels()
+
+	read := func(n uint) int {
+		v, _ := br.readBits(n)
+		return int(v)
+	}
+
+	if h.lsf {
+		si.mainDataBegin = read(8)
+		read(uint(channels)) // private bits
+	} else {
+		si.mainDataBegin = read(9)
+		read(uint(7 - 2*channels))
+		for ch := 0; ch < channels; ch++ {
+			for band := 0; band < 4; band++ {
+				si.scfsi[ch][band] = read(1) == 1
+			}
+		}
+	}
+
+	for gr := 0; gr < h.granules(); gr++ {
+		for ch := 0; ch < channels; ch++ {
+			g := &si.granules[gr][ch]
+			g.part23Length = read(12)
+			g.bigValues = read(9)
+			g.globalGain = read(8)
+			if h.lsf {
+				g.scalefacCompress = read(9)
+			} else {
+				g.scalefacCompress = read(4)
+			}
+
+			if read(1) == 1 {
+				// window switching
+				g.blockType = read(2)
+				g.mixed = read(1) == 1
+				for i := 0; i < 2; i++ {
+					g.tableSelect[i] = read(5)
+				}
+				for i := 0; i < 3; i++ {
+					g.subblockGain[i] = read(3)
+				}
+
+				// the regions are implicit, the second one running to
+				// the end of the big values
+				g.region0Count = 7
+				if g.blockType == 2 && !g.mixed {
+					g.region0Count = 8
+				}
+				g.region1Count = 36
+			} else {
+				for i := 0; i < 3; i++ {
+					g.tableSelect[i] = read(5)
+				}
+				g.region0Count = read(4)
+				g.region1Count = read(3)
+			}
+
+			if !h.lsf {
+				g.preflag = read(1) == 1
+			}
+			g.scalefacScale = read(1)
+			g.count1Table = read(1)
+		}
+	}
+
+	return si
+}
+
+// mp3Bands holds the scalefactor band boundaries of a sampling frequency.
+type mp3Bands struct {
+	long  [23]int
+	short [14]int
+}
+
+var mp3BandsBySampleRate = map[int]*mp3Bands{
+	44100: {
+		long:  [23]int{0, 4, 8, 12, 16, 20, 24, 30, 36, 44, 52, 62, 74, 90, 110, 134, 162, 196, 238, 288, 342, 418, 576},
+		short: [14]int{0, 4, 8, 12, 16, 22, 30, 40, 52, 66, 84, 106, 136, 192},
+	},
+	48000: {
+		long:  [23]int{0, 4, 8, 12, 16, 20, 24, 30, 36, 42, 50, 60, 72, 88, 106, 128, 156, 190, 230, 276, 330, 384, 576},
+		short: [14]int{0, 4, 8, 12, 16, 22, 28, 38, 50, 64, 80, 100, 126, 192},
+	},
+	32000: {
+		long:  [23]int{0, 4, 8, 12, 16, 20, 24, 30, 36, 44, 54, 66, 82, 102, 126, 156, 194, 240, 296, 364, 448, 550, 576},
+		short: [14]int{0, 4, 8, 12, 16, 22, 30, 42, 58, 78, 104, 138, 180, 192},
+	},
+	22050: {
+		long:  [23]int{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 116, 140, 168, 200, 238, 284, 336, 396, 464, 522, 576},
+		short: [14]int{0, 4, 8, 12, 18, 24, 32, 42, 56, 74, 100, 132, 174, 192},
+	},
+	24000: {
+		long:  [23]int{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 114, 136, 162, 194, 232, 278, 332, 394, 464, 540, 576},
+		short: [14]int{0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 136, 180, 192},
+	},
+	16000: &mp3Bands16000,
+	11025: &mp3Bands16000,
+	12000: &mp3Bands16000,
+	8000: {
+		long:  [23]int{0, 12, 24, 36, 48, 60, 72, 88, 108, 132, 160, 192, 232, 280, 336, 400, 476, 566, 568, 570, 572, 574, 576},
+		short: [14]int{0, 8, 16, 24, 36, 52, 72, 96, 124, 160, 162, 164, 166, 192},
+	},
+}
+
+var mp3Bands16000 = mp3Bands{
+	long:  [23]int{0, 6, 12, 18, 24, 30, 36, 44, 54, 66, 80, 96, 116, 140, 168, 200, 238, 284, 336, 396, 464, 522, 576},
+	short: [14]int{0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
+}
+
+// slen1 and slen2 of the MPEG-1 scalefac_compress values
+var mp3Slen = [16][2]int{
+	{0, 0}, {0, 1}, {0, 2}, {0, 3}, {3, 0}, {1, 1}, {1, 2}, {1, 3},
+	{2, 1}, {2, 2}, {2, 3}, {3, 1}, {3, 2}, {3, 3}, {4, 2}, {4, 3},
+}
+
+// mp3LsfScalefacCounts holds the number of scalefactors read with each of the
+// four slen values of MPEG-2, by scalefac_compress range and by long, short
+// or mixed blocks.
+var mp3LsfScalefacCounts = [6][3][4]int{
+	{{6, 5, 5, 5}, {9, 9, 9, 9}, {6, 9, 9, 9}},
+	{{6, 5, 7, 3}, {9, 9, 12, 6}, {6, 9, 12, 6}},
+	{{11, 10, 0, 0}, {18, 18, 0, 0}, {15, 18, 0, 0}},
+	{{7, 7, 7, 0}, {12, 12, 12, 0}, {6, 15, 12, 0}},
+	{{6, 6, 6, 3}, {12, 9, 9, 6}, {6, 12, 9, 6}},
+	{{8, 8, 5, 0}, {15, 12, 9, 0}, {6, 18, 9, 0}},
+}
+
+var mp3Pretab = [22]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 3, 2, 0}
+
+var mp3Linbits = [32]uint{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4, 6, 8, 10, 13, 4, 5, 6, 7, 8, 9, 11, 13}
+
+// huffmanTree is a binary tree of codes; nodes hold the indexes of their
+// children, and leaves hold ^(x<<4 | y), x and y being the coded values.
+type huffmanTree [][2]int32
+
+// newHuffmanTree builds the tree of codes indexed by x*size+y.
+func newHuffmanTree(codes []huffmanCode, size int) huffmanTree {
+	tree := huffmanTree{{}}
+	for i, c := range codes {
+		value := i/size<<4 | i%size
+		node := 0
+		for i := int(c.length) - 1; i >= 0; i-- {
+			bit := c.code >> i & 1
+			if i == 0 {
+				tree[node][bit] = ^int32(value)
+				break
+			}
+			if tree[node][bit] == 0 {
+				tree = append(tree, [2]int32{})
+				tree[node][bit] = int32(len(tree) - 1)
+			}
+			node = int(tree[node][bit])
+		}
+	}
+
+	return tree
+}
+
+var huffmanPairTrees, huffmanQuadTree = func() ([32]huffmanTree, huffmanTree) {
+	var trees [32]huffmanTree
+	for i := range trees {
+		table := i
+		if i >= 24 {
+			table = 24
+		} else if i >= 16 {
+			table = 16
+		}
+		if codes := huffmanPairCodes[table]; codes != nil {
+			size := 1
+			for size*size < len(codes) {
+				size++
+			}
+			trees[i] = newHuffmanTree(codes, size)
+		}
+	}
+
+	return trees, newHuffmanTree(huffmanQuadCodes, 16)
+}()
+
+// mainData is the bit stream of the main data of a frame, which can start in
+// the previous frames; reading past its end returns zeros.
+type mainData struct {
+	buf []byte
+	pos int // in bits
+}
+
+func (m *mainData) readBits(n int) int {
+	var v int
+	for ; n > 0; n-- {
+		v <<= 1
+		if i := m.pos >> 3; i < len(m.buf) {
+			v |= int(m.buf[i] >> (7 - m.pos&7) & 1)
+		}
+		m.pos++
+	}
+
+	return v
+}
+
+func (m *mainData) decode(tree huffmanTree) int {
+	node := int32(0)
+	for {
+		next := tree[node][m.readBits(1)]
+		if next < 0 {
+			return int(^next)
+		}
+		if next == 0 {
+			// an invalid code, only possible in corrupt streams
+			return 0
+		}
+		node = next
+	}
+}
+
+var mp3Pow43 = func() [8207]float64 {
+	var t [8207]float64
+	for i := range t {
+		t[i] = math.Pow(float64(i), 4.0/3)
+	}
+
+	return t
+}()
+
+// the antialias butterfly coefficients
+var mp3CS, mp3CA = func() ([8]float64, [8]float64) {
+	c := [8]float64{-0.6, -0.535, -0.33, -0.185, -0.095, -0.041, -0.0142, -0.0037}
+	var cs, ca [8]float64
+	for i, v := range c {
+		cs[i] = 1 / math.Sqrt(1+v*v)
+		ca[i] = v / math.Sqrt(1+v*v)
+	}
+
+	return cs, ca
+}()
+
+// mp3Windows holds the IMDCT windows of the long block types; short blocks
+// use mp3ShortWindow.
+var mp3Windows, mp3ShortWindow = func() ([4][36]float64, [12]float64) {
+	var w [4][36]float64
+	for i := 0; i < 36; i++ {
+		w[0][i] = math.Sin(math.Pi / 36 * (float64(i) + 0.5))
+	}
+	for i := 0; i < 18; i++ {
+		w[1][i] = w[0][i]
+		w[3][i+18] = w[0][i+18]
+	}
+	for i := 18; i < 24; i++ {
+		w[1][i] = 1
+		w[3][i-6] = 1
+	}
+	for i := 24; i < 30; i++ {
+		w[1][i] = math.Sin(math.Pi / 12 * (float64(i-18) + 0.5))
+		w[3][i-18] = math.Sin(math.Pi / 12 * (float64(i-24) + 0.5))
+	}
+
+	var short [12]float64
+	for i := range short {
+		short[i] = math.Sin(math.Pi / 12 * (float64(i) + 0.5))
+	}
+
+	return w, short
+}()
+
+var mp3CosLong, mp3CosShort = func() ([36][18]float64, [12][6]float64) {
+	var long [36][18]float64
+	for i := range long {
+		for k := range long[i] {
+			long[i][k] = math.Cos(math.Pi / 72 * float64((2*i+19)*(2*k+1)))
+		}
+	}
+
+	var short [12][6]float64
+	for i := range short {
+		for k := range short[i] {
+			short[i][k] = math.Cos(math.Pi / 24 * float64((2*i+7)*(2*k+1)))
+		}
+	}
+
+	return long, short
+}()
+
+// mp3SynthesisWindow is the window D of the synthesis filter bank, derived
+// from the first half of its coefficients, in units of 2^-16; the second
+// half mirrors them with the sign flipped, except every 64th one.
+var mp3SynthesisWindow = func() [512]float64 {
+	half := [257]int{
+		0, -1, -1, -1, -1, -1, -1, -2, -2, -2, -2, -3, -3, -4, -4, -5,
+		-5, -6, -7, -7, -8, -9, -10, -11, -13, -14, -16, -17, -19, -21, -24, -26,
+		-29, -31, -35, -38, -41, -45, -49, -53, -58, -63, -68, -73, -79, -85, -91, -97,
+		-104, -111, -117, -125, -132, -139, -147, -154, -161, -169, -176, -183, -190, -196, -202, -208,
+		213, 218, 222, 225, 227, 228, 228, 227, 224, 221, 215, 208, 200, 189, 177, 163,
+		146, 127, 106, 83, 57, 29, -2, -36, -72, -111, -153, -197, -244, -294, -347, -401,
+		-459, -519, -581, -645, -711, -779, -848, -919, -991, -1064, -1137, -1210, -1283, -1356, -1428, -1498,
+		-1567, -1634, -1698, -1759, -1817, -1870, -1919, -1962, -2001, -2032, -2057, -2075, -2085, -2087, -2080, -2063,
+		2037, 2000, 1952, 1893, 1822, 1739, 1644, 1535, 1414, 1280, 1131, 970, 794, 605, 402, 185,
+		-45, -288, -545, -814, -1095, -1388, -1692, -2006, -2330, -2663, -3004, -3351, -3705, -4063, -4425, -4788,
+		-5153, -5517, -5879, -6237, -6589, -6935, -7271, -7597, -7910, -8209, -8491, -8755, -8998, -9219, -9416, -9585,
+		-9727, -9838, -9916, -9959, -9966, -9935, -9863, -9750, -9592, -9389, -9139, -8840, -8492, -8092, -7640, -7134,
+		6574, 5959, 5288, 4561, 3776, 2935, 2037, 1082, 70, -998, -2122, -3300, -4533, -5818, -7154, -8540,
+		-9975, -11455, -12980, -14548, -16155, -17799, -19478, -21189, -22929, -24694, -26482, -28289, -30112, -31947, -33791, -35640,
+		-37489, -39336, -41176, -43006, -44821, -46617, -48390, -50137, -51853, -53534, -55178, -56778, -58333, -59838, -61289, -62684,
+		-64019, -65290, -66494, -67629, -68692, -69679, -70590, -71420, -72169, -72835, -73415, -73908, -74313, -74630, -74856, -74992,
+		75038,
+	}
+
+	var d [512]float64
+	for i, v := range half {
+		d[i] = float64(v) / (1 << 16)
+	}
+	for i := 257; i < 512; i++ {
+		if i%64 == 0 {
+			d[i] = d[512-i]
+		} else {
+			d[i] = -d[512-i]
+		}
+	}
+
+	return d
+}()
+
+// mp3Channel holds the state kept between granules for one channel.
+type mp3Channel struct {
+	scalefacL [22]int
+	scalefacS [13][3]int
+
+	// the largest scalefactors of MPEG-2 bands, which mark the bands that
+	// aren't intensity coded
+	scalefacMaxL [22]int
+	scalefacMaxS [13]int
+
+	overlap [32][18]float64
+	v       [1024]float64
+	vOffset int
+}
+
+// mp3Decoder decodes the frames of a Layer III stream into PCM samples.
+type mp3Decoder struct {
+	reservoir []byte
+	channels  [2]mp3Channel
+
+	// peaksOnly skips the hybrid and polyphase filter banks, filling each
+	// granule with an estimate of its level instead
+	peaksOnly bool
+}
+
+// decodeFrame decodes a whole frame, header included, appending its samples
+// to out; frames whose main data starts in missing frames decode to silence.
+func (d *mp3Decoder) decodeFrame(frame []byte, h mp3Header, out [][]float32) [][]float32 {
+	channels := h.channels()
+
+	start := 4
+	if h.protected {
+		start += 2
+	}
+	sideInfoEnd := start + h.sideInfoSize()
+	if sideInfoEnd > len(frame) {
+		return appendSilence(out, channels, h.samplesPerFrame())
+	}
+
+	si := readMP3SideInfo(frame[start:sideInfoEnd], h)
+
+	body := frame[sideInfoEnd:]
+	if si.mainDataBegin > len(d.reservoir) {
+		d.keepReservoir(body)
+		return appendSilence(out, channels, h.samplesPerFrame())
+	}
+
+	data := make([]byte, 0, si.mainDataBegin+len(body))
+	data = append(data, d.reservoir[len(d.reservoir)-si.mainDataBegin:]...)
+	data = append(data, body...)
+	d.keepReservoir(body)
+
+	m := &mainData{buf: data}
+	bands := mp3BandsBySampleRate[h.sampleRate]
+
+	var pcm [576]float64
+	for gr := 0; gr < h.granules(); gr++ {
+		var xr [2][576]float64
+		for ch := 0; ch < channels; ch++ {
+			g := &si.granules[gr][ch]
+			part2Start := m.pos
+
+			if h.lsf {
+				d.readLsfScalefactors(m, g, ch, h)
+			} else {
+				d.readScalefactors(m, g, ch, gr, si.scfsi[ch])
+			}
+
+			values, count := readHuffmanValues(m, g, bands, h.lsf, part2Start+g.part23Length)
+			m.pos = part2Start + g.part23Length
+
+			d.requantize(&values, count, g, ch, bands, &xr[ch])
+		}
+
+		if h.mode == mp3JointStereo {
+			d.processStereo(h, &si.granules[gr][1], bands, &xr)
+		}
+
+		for ch := 0; ch < channels; ch++ {
+			g := &si.granules[gr][ch]
+
+			if d.peaksOnly {
+				level := estimateLevel(g, &xr[ch])
+				for i := 0; i < 576; i++ {
+					out[ch] = append(out[ch], level)
+				}
+				continue
+			}
+
+			reorder(g, bands, &xr[ch])
+			antialias(g, &xr[ch])
+			d.hybridSynthesis(g, ch, &xr[ch], &pcm)
+			d.polyphaseSynthesis(ch, &pcm, &out[ch])
+		}
+	}
+
+	return out
+}
+
+// skipFrame appends silence in place of the samples of a frame that aren't
+// needed, only keeping its main data for the frames that follow.
+func (d *mp3Decoder) skipFrame(frame []byte, h mp3Header, out [][]float32) [][]float32 {
+	start := 4
+	if h.protected {
+		start += 2
+	}
+	if sideInfoEnd := start + h.sideInfoSize(); sideInfoEnd <= len(frame) {
+		d.keepReservoir(frame[sideInfoEnd:])
+	}
+
+	return appendSilence(out, h.channels(), h.samplesPerFrame())
+}
+
+func appendSilence(out [][]float32, channels, n int) [][]float32 {
+	for ch := 0; ch < channels; ch++ {
+		out[ch] = append(out[ch], make([]float32, n)...)
+	}
+
+	return out
+}
+
+// keepReservoir appends the main data of a frame to the bit reservoir, which
+// only needs the last 511 bytes.
+func (d *mp3Decoder) keepReservoir(body []byte) {
+	d.reservoir = append(d.reservoir, body...)
+	if extra := len(d.reservoir) - 511; extra > 0 {
+		d.reservoir = append(d.reservoir[:0], d.reservoir[extra:]...)
+	}
+}
+
+func (d *mp3Decoder) readScalefactors(m *mainData, g *mp3Granule, ch, gr int, scfsi [4]bool) {
+	c := &d.channels[ch]
+	slen1, slen2 := mp3Slen[g.scalefacCompress][0], mp3Slen[g.scalefacCompress][1]
+
+	if g.blockType == 2 {
+		startShort := 0
+		if g.mixed {
+			for sfb := 0; sfb < 8; sfb++ {
+				c.scalefacL[sfb] = m.readBits(slen1)
+			}
+			startShort = 3
+		}
+		for sfb := startShort; sfb < 12; sfb++ {
+			slen := slen1
+			if sfb >= 6 {
+				slen = slen2
+			}
+			for w := 0; w < 3; w++ {
+				c.scalefacS[sfb][w] = m.readBits(slen)
+			}
+		}
+
+		return
+	}
+
+	// the second granule can reuse groups of scalefactors of the first one
+	groups := [5]int{0, 6, 11, 16, 21}
+	for group := 0; group < 4; group++ {
+		if gr == 1 && scfsi[group] {
+			continue
+		}
+
+		slen := slen1
+		if group >= 2 {
+			slen = slen2
+		}
+		for sfb := groups[group]; sfb < groups[group+1]; sfb++ {
+			c.scalefacL[sfb] = m.readBits(slen)
+		}
+	}
+}
+
+func (d *mp3Decoder) readLsfScalefactors(m *mainData, g *mp3Granule, ch int, h mp3Header) {
+	c := &d.channels[ch]
+	sfc := g.scalefacCompress
+
+	var slen [4]int
+	var table int
+	if ch == 1 && h.modeExtension&1 != 0 {
+		// the right channel of intensity stereo
+		sfc >>= 1
+		switch {
+		case sfc < 180:
+			slen = [4]int{sfc / 36, sfc % 36 / 6, sfc % 36 % 6, 0}
+			table = 3
+		case sfc < 244:
+			sfc -= 180
+			slen = [4]int{sfc % 64 >> 4, sfc % 16 >> 2, sfc % 4, 0}
+			table = 4
+		default:
+			sfc -= 244
+			slen = [4]int{sfc / 3, sfc % 3, 0, 0}
+			table = 5
+		}
+	} else {
+		switch {
+		case sfc < 400:
+			slen = [4]int{sfc >> 4 / 5, sfc >> 4 % 5, sfc & 15 >> 2, sfc & 3}
+		case sfc < 500:
+			sfc -= 400
+			slen = [4]int{sfc >> 2 / 5, sfc >> 2 % 5, sfc & 3, 0}
+			table = 1
+		default:
+			sfc -= 500
+			slen = [4]int{sfc / 3, sfc % 3, 0, 0}
+			table = 2
+			g.preflag = true
+		}
+	}
+
+	blocks := 0
+	if g.blockType == 2 {
+		blocks = 1
+		if g.mixed {
+			blocks = 2
+		}
+	}
+
+	var values, maxValues []int
+	for i, count := range mp3LsfScalefacCounts[table][blocks] {
+		for j := 0; j < count; j++ {
+			values = append(values, m.readBits(slen[i]))
+			maxValues = append(maxValues, 1<<slen[i]-1)
+		}
+	}
+
+	i := 0
+	if g.blockType != 2 || g.mixed {
+		longBands := 21
+		if g.mixed {
+			longBands = 6
+		}
+		for sfb := 0; sfb < longBands && i < len(values); sfb++ {
+			c.scalefacL[sfb] = values[i]
+			c.scalefacMaxL[sfb] = maxValues[i]
+			i++
+		}
+	}
+	if g.blockType == 2 {
+		startShort := 0
+		if g.mixed {
+			startShort = 3
+		}
+		for sfb := startShort; sfb < 12; sfb++ {
+			for w := 0; w < 3 && i < len(values); w++ {
+				c.scalefacS[sfb][w] = values[i]
+				c.scalefacMaxS[sfb] = maxValues[i]
+				i++
+			}
+		}
+	}
+}
+
+// bandWidths lists the widths of the scalefactor bands in the order their
+// values are coded: short bands appear once per window.
+func bandWidths(g *mp3Granule, bands *mp3Bands, lsf bool) []int {
+	var widths []int
+	if g.blockType != 2 || g.mixed {
+		longBands := 22
+		if g.blockType == 2 {
+			longBands = 8
+			if lsf {
+				longBands = 6
+			}
+		}
+		for sfb := 0; sfb < longBands; sfb++ {
+			widths = append(widths, bands.long[sfb+1]-bands.long[sfb])
+		}
+	}
+
+	if g.blockType == 2 {
+		startShort := 0
+		if g.mixed {
+			startShort = 3
+		}
+		for sfb := startShort; sfb < 13; sfb++ {
+			width := bands.short[sfb+1] - bands.short[sfb]
+			widths = append(widths, width, width, width)
+		}
+	}
+
+	return widths
+}
+
+// readHuffmanValues decodes the quantized values of a granule, up to the end
+// of its part2_3 bits, returning them with the number of values read.
+func readHuffmanValues(m *mainData, g *mp3Granule, bands *mp3Bands, lsf bool, end int) ([576]int, int) {
+	var values [576]int
+
+	widths := bandWidths(g, bands, lsf)
+	regionEnd := func(count int) int {
+		n := 0
+		for i := 0; i < count && i < len(widths); i++ {
+			n += widths[i]
+		}
+		if count >= len(widths) {
+			return 576
+		}
+
+		return n
+	}
+	region1Start := regionEnd(g.region0Count + 1)
+	region2Start := regionEnd(g.region0Count + g.region1Count + 2)
+
+	bigValues := g.bigValues * 2
+	if bigValues > 576 {
+		bigValues = 576
+	}
+
+	i := 0
+	for ; i < bigValues; i += 2 {
+		table := g.tableSelect[2]
+		if i < region1Start {
+			table = g.tableSelect[0]
+		} else if i < region2Start {
+			table = g.tableSelect[1]
+		}
+
+		tree := huffmanPairTrees[table]
+		if tree == nil {
+			continue
+		}
+
+		v := m.decode(tree)
+		x, y := v>>4, v&0xF
+
+		linbits := mp3Linbits[table]
+		if linbits > 0 && x == 15 {
+			x += m.readBits(int(linbits))
+		}
+		if x != 0 && m.readBits(1) == 1 {
+			x = -x
+		}
+		if linbits > 0 && y == 15 {
+			y += m.readBits(int(linbits))
+		}
+		if y != 0 && m.readBits(1) == 1 {
+			y = -y
+		}
+
+		values[i], values[i+1] = x, y
+	}
+
+	// the count1 region of quadruples of -1, 0 and 1 runs until the end of
+	// the bits; a quadruple that goes past it is discarded
+	for i+4 <= 576 && m.pos < end {
+		var v int
+		if g.count1Table == 1 {
+			v = 15 - m.readBits(4)
+		} else {
+			v = m.decode(huffmanQuadTree)
+		}
+
+		var quad [4]int
+		for j := 0; j < 4; j++ {
+			if v>>(3-j)&1 == 1 {
+				quad[j] = 1
+				if m.readBits(1) == 1 {
+					quad[j] = -1
+				}
+			}
+		}
+
+		if m.pos > end {
+			break
+		}
+
+		copy(values[i:], quad[:])
+		i += 4
+	}
+
+	return values, i
+}
+
+func (d *mp3Decoder) requantize(values *[576]int, count int, g *mp3Granule, ch int, bands *mp3Bands, xr *[576]float64) {
+	c := &d.channels[ch]
+	gain := float64(g.globalGain-210) / 4
+	multiplier := 0.5 * float64(1+g.scalefacScale)
+
+	dequantize := func(i int, scale float64) {
+		v := values[i]
+		if v == 0 {
+			return
+		}
+
+		magnitude := v
+		if v < 0 {
+			magnitude = -v
+		}
+
+		var q float64
+		if magnitude < len(mp3Pow43) {
+			q = mp3Pow43[magnitude]
+		} else {
+			q = math.Pow(float64(magnitude), 4.0/3)
+		}
+		if v < 0 {
+			q = -q
+		}
+
+		xr[i] = q * scale
+	}
+
+	i := 0
+	if g.blockType != 2 || g.mixed {
+		longEnd := 576
+		if g.blockType == 2 {
+			longEnd = 36
+		}
+
+		for sfb := 0; i < count && i < longEnd; sfb++ {
+			pretab := 0
+			if g.preflag {
+				pretab = mp3Pretab[sfb]
+			}
+			scale := math.Exp2(gain - multiplier*float64(c.scalefacL[sfb]+pretab))
+			for ; i < bands.long[sfb+1] && i < count; i++ {
+				dequantize(i, scale)
+			}
+		}
+	}
+
+	if g.blockType == 2 {
+		startShort := 0
+		if g.mixed {
+			startShort = 3
+		}
+
+		for sfb := startShort; sfb < 13; sfb++ {
+			width := bands.short[sfb+1] - bands.short[sfb]
+			for w := 0; w < 3; w++ {
+				scale := math.Exp2(gain - 2*float64(g.subblockGain[w]) - multiplier*float64(c.scalefacS[sfb][w]))
+				base := 3*bands.short[sfb] + w*width
+				for j := 0; j < width && base+j < count; j++ {
+					dequantize(base+j, scale)
+				}
+			}
+		}
+	}
+}
+
+// processStereo undoes the joint stereo coding of a granule, before the
+// short blocks are reordered; g is the side information of the right
+// channel, which intensity stereo takes the positions from.
+func (d *mp3Decoder) processStereo(h mp3Header, g *mp3Granule, bands *mp3Bands, xr *[2][576]float64) {
+	ms := h.modeExtension&2 != 0
+	intensity := h.modeExtension&1 != 0
+
+	var done [576]bool
+	if intensity {
+		right := &d.channels[1]
+		apply := func(i int, position, max int) {
+			if position == max && h.lsf || position >= 7 && !h.lsf {
+				// not intensity coded; the 4-bit scalefactors of the lower
+				// bands can hold positions past 7 as well
+				return
+			}
+
+			var left, right float64
+			if h.lsf {
+				// intensity_scale is the lowest bit of scalefac_compress
+				io := math.Pow(2, -0.25*float64(1+g.scalefacCompress&1))
+				left, right = 1, 1
+				if position%2 == 1 {
+					left = math.Pow(io, float64(position+1)/2)
+				} else if position > 0 {
+					right = math.Pow(io, float64(position)/2)
+				}
+			} else {
+				ratio := math.Tan(float64(position) * math.Pi / 12)
+				left, right = ratio/(1+ratio), 1/(1+ratio)
+				if position == 6 {
+					left, right = 1, 0
+				}
+			}
+
+			xr[1][i] = xr[0][i] * right
+			xr[0][i] *= left
+			done[i] = true
+		}
+
+		// the intensity coded long bands follow the last non-zero value of
+		// the right channel below the end of the long bands
+		applyLong := func(end int) {
+			last := -1
+			for i := bands.long[end] - 1; i >= 0; i-- {
+				if xr[1][i] != 0 {
+					last = i
+					break
+				}
+			}
+
+			first := 0
+			for first < end && bands.long[first] <= last {
+				first++
+			}
+
+			for sfb := first; sfb < end; sfb++ {
+				band := sfb
+				if band > 20 {
+					band = 20
+				}
+				for i := bands.long[sfb]; i < bands.long[sfb+1]; i++ {
+					apply(i, right.scalefacL[band], right.scalefacMaxL[band])
+				}
+			}
+		}
+
+		if g.blockType == 2 {
+			startShort := 0
+			if g.mixed {
+				startShort = 3
+			}
+
+			// in each window, the intensity coded bands follow the last
+			// non-zero band of the right channel
+			empty := true
+			for w := 0; w < 3; w++ {
+				first := startShort
+				for sfb := startShort; sfb < 13; sfb++ {
+					width := bands.short[sfb+1] - bands.short[sfb]
+					base := 3*bands.short[sfb] + w*width
+					for j := 0; j < width; j++ {
+						if xr[1][base+j] != 0 {
+							first = sfb + 1
+							break
+						}
+					}
+				}
+				if first > startShort {
+					empty = false
+				}
+
+				for sfb := first; sfb < 13; sfb++ {
+					band := sfb
+					if band > 11 {
+						band = 11
+					}
+					width := bands.short[sfb+1] - bands.short[sfb]
+					base := 3*bands.short[sfb] + w*width
+					for j := 0; j < width; j++ {
+						apply(base+j, right.scalefacS[band][w], right.scalefacMaxS[band])
+					}
+				}
+			}
+
+			// the long bands of mixed blocks are only intensity coded when
+			// the right channel has nothing in the short ones
+			if g.mixed && empty {
+				longBands := 8
+				if h.lsf {
+					longBands = 6
+				}
+				applyLong(longBands)
+			}
+		} else {
+			applyLong(22)
+		}
+	}
+
+	if ms {
+		for i := 0; i < 576; i++ {
+			if done[i] {
+				continue
+			}
+			mid, side := xr[0][i], xr[1][i]
+			xr[0][i] = (mid + side) / math.Sqrt2
+			xr[1][i] = (mid - side) / math.Sqrt2
+		}
+	}
+}
+
+// estimateLevel approximates the peak level of a granule from the energy of
+// its spectrum, which the filter banks keep up to a known gain.
+func estimateLevel(g *mp3Granule, xr *[576]float64) float32 {
+	var energy float64
+	for i, v := range xr {
+		// the first two subbands of mixed blocks are long blocks
+		if g.blockType == 2 && (!g.mixed || i >= 36) {
+			energy += v * v * mp3ShortBlockGain
+		} else {
+			energy += v * v * mp3LongBlockGain
+		}
+	}
+
+	// a sine wave's peak is √2 times its RMS level
+	level := math.Sqrt(2 * energy / 576)
+	if level > 1 {
+		level = 1
+	}
+
+	return float32(level)
+}
+
+// The gains in energy of the filter banks, which aren't normalized: the IMDCT
+// of n values scales their energy by n/2, which is 9 for the 18 values of
+// long blocks and 3 for the 6 values of each window of short blocks, and the
+// polyphase synthesis scales it by its 32 subbands.
+const (
+	mp3LongBlockGain  = 18 / 2 * 32
+	mp3ShortBlockGain = 6 / 2 * 32
+)
+
+// reorder puts the values of short blocks, coded band by band for each
+// window, into the order of the subbands, with the windows interleaved.
+func reorder(g *mp3Granule, bands *mp3Bands, xr *[576]float64) {
+	if g.blockType != 2 {
+		return
+	}
+
+	startShort := 0
+	if g.mixed {
+		startShort = 3
+	}
+
+	tmp := *xr
+	for sfb := startShort; sfb < 13; sfb++ {
+		width := bands.short[sfb+1] - bands.short[sfb]
+		base := 3 * bands.short[sfb]
+		for w := 0; w < 3; w++ {
+			for j := 0; j < width; j++ {
+				xr[base+3*j+w] = tmp[base+w*width+j]
+			}
+		}
+	}
+}
+
+// antialias reduces the aliasing between the subbands of long blocks.
+func antialias(g *mp3Granule, xr *[576]float64) {
+	subbands := 32
+	if g.blockType == 2 {
+		if !g.mixed {
+			return
+		}
+		subbands = 2
+	}
+
+	for sb := 1; sb < subbands; sb++ {
+		for i := 0; i < 8; i++ {
+			lower, upper := xr[18*sb-1-i], xr[18*sb+i]
+			xr[18*sb-1-i] = lower*mp3CS[i] - upper*mp3CA[i]
+			xr[18*sb+i] = upper*mp3CS[i] + lower*mp3CA[i]
+		}
+	}
+}
+
+// hybridSynthesis runs the IMDCT of every subband, overlapping its first
+// half with the second half of the previous granule's, and inverts the
+// frequencies of the odd subbands.
+func (d *mp3Decoder) hybridSynthesis(g *mp3Granule, ch int, xr *[576]float64, out *[576]float64) {
+	c := &d.channels[ch]
+
+	for sb := 0; sb < 32; sb++ {
+		in := xr[18*sb : 18*sb+18]
+
+		silent := true
+		for _, v := range in {
+			if v != 0 {
+				silent = false
+				break
+			}
+		}
+
+		var raw [36]float64
+		blockType := g.blockType
+		if g.mixed && sb < 2 {
+			blockType = 0
+		}
+
+		if silent {
+			// nothing to transform
+		} else if blockType == 2 {
+			for w := 0; w < 3; w++ {
+				for i := 0; i < 12; i++ {
+					var sum float64
+					for k := 0; k < 6; k++ {
+						sum += in[3*k+w] * mp3CosShort[i][k]
+					}
+					raw[6+6*w+i] += sum * mp3ShortWindow[i]
+				}
+			}
+		} else {
+			// the outputs are symmetric: the ones in [9, 18) mirror the
+			// ones in [0, 9) negated, and the ones in [27, 36) mirror the
+			// ones in [18, 27)
+			for i := 0; i < 9; i++ {
+				var low, high float64
+				for k := 0; k < 18; k++ {
+					low += in[k] * mp3CosLong[i][k]
+					high += in[k] * mp3CosLong[i+18][k]
+				}
+				raw[i], raw[17-i] = low, -low
+				raw[i+18], raw[35-i] = high, high
+			}
+			for i := range raw {
+				raw[i] *= mp3Windows[blockType][i]
+			}
+		}
+
+		for i := 0; i < 18; i++ {
+			v := raw[i] + c.overlap[sb][i]
+			if sb%2 == 1 && i%2 == 1 {
+				v = -v
+			}
+			out[18*sb+i] = v
+			c.overlap[sb][i] = raw[i+18]
+		}
+	}
+}
+
+// polyphaseSynthesis turns the 18 time slots of 32 subband samples into
+// 576 PCM samples.
+func (d *mp3Decoder) polyphaseSynthesis(ch int, in *[576]float64, out *[]float32) {
+	c := &d.channels[ch]
+
+	var s [32]float64
+	for t := 0; t < 18; t++ {
+		for sb := 0; sb < 32; sb++ {
+			s[sb] = in[18*sb+t]
+		}
+		dct32(&s)
+
+		// shift the 1024 V values by 64, then fill in the new ones from
+		// the DCT
+		c.vOffset = (c.vOffset - 64) & 1023
+		v := func(i int) *float64 {
+			return &c.v[(c.vOffset+i)&1023]
+		}
+		for i := 0; i < 16; i++ {
+			*v(i) = s[i+16]
+		}
+		*v(16) = 0
+		for i := 17; i < 48; i++ {
+			*v(i) = -s[48-i]
+		}
+		for i := 48; i < 64; i++ {
+			*v(i) = -s[i-48]
+		}
+
+		for j := 0; j < 32; j++ {
+			var sum float64
+			for i := 0; i < 8; i++ {
+				sum += c.v[(c.vOffset+128*i+j)&1023] * mp3SynthesisWindow[64*i+j]
+				sum += c.v[(c.vOffset+128*i+96+j)&1023] * mp3SynthesisWindow[64*i+32+j]
+			}
+
+			if sum > 1 {
+				sum = 1
+			} else if sum < -1 {
+				sum = -1
+			}
+			*out = append(*out, float32(sum))
+		}
+	}
+}
+
+// dct32 computes the unnormalized DCT-II of 32 values in place, using Lee's
+// recursive algorithm.
+func dct32(x *[32]float64) {
+	var tmp [32]float64
+	fastDCT(x[:], tmp[:])
+}
+
+// dctFactors holds 1/(2cos((i+0.5)π/n)) for the sizes n of fastDCT.
+var dctFactors = func() [33][]float64 {
+	var factors [33][]float64
+	for n := 2; n <= 32; n *= 2 {
+		for i := 0; i < n/2; i++ {
+			factors[n] = append(factors[n], 1/(2*math.Cos((float64(i)+0.5)*math.Pi/float64(n))))
+		}
+	}
+
+	return factors
+}()
+
+func fastDCT(x, tmp []float64) {
+	n := len(x)
+	if n == 1 {
+		return
+	}
+
+	half := n / 2
+	factors := dctFactors[n]
+	for i := 0; i < half; i++ {
+		a, b := x[i], x[n-1-i]
+		tmp[i] = a + b
+		tmp[i+half] = (a - b) * factors[i]
+	}
+
+	fastDCT(tmp[:half], x[:half])
+	fastDCT(tmp[half:], x[half:])
+
+	for i := 0; i < half-1; i++ {
+		x[2*i] = tmp[i]
+		x[2*i+1] = tmp[i+half] + tmp[i+half+1]
+	}
+	x[n-2] = tmp[half-1]
+	x[n-1] = tmp[n-1]
+}
@@ -0,0 +1,299 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MP3Info holds the properties of an MP3 stream that have no WAVE
+// counterpart.
+type MP3Info struct {
+	Version string // MPEG-1, MPEG-2 or MPEG-2.5
+	Frames  int64
+	VBR     bool   // whether the bitrate varies between frames
+	Encoder string // from the LAME tag, if any
+
+	// the number of samples the encoder added at the start and at the end,
+	// which are removed from the decoded audio
+	EncoderDelay int
+	Padding      int
+}
+
+// mp3DecoderDelay is the number of samples the decoder itself delays the
+// audio by, which gapless playback removes along with the encoder delay.
+const mp3DecoderDelay = 529
+
+// parseMP3 decodes the frames of an MPEG-1/2 Layer III stream, after any
+// ID3v2 tag, into the same structure that WAVE files are read into.
+func parseMP3(cr *chunkReader, wav *Wav, options Options) error {
+	wav.AudioFormat = FormatMPEGLayer3
+	wav.Signed = true
+
+	decoder := &mp3Decoder{peaksOnly: options.PeaksOnly}
+	var info *MP3Info
+	var gapless bool
+	var bitrate, samplesPerFrame int
+	var frames int64 // the number of audio frames that were only counted
+
+	// the samples kept with gapless playback, and the number decoded so far
+	var keepFrom, keepTo, decoded int64 = 0, -1, 0
+	var block [][]float32
+
+	start := cr.offset
+	frame := make([]byte, 0, 2048)
+
+	for {
+		b, _ := cr.Peek(4)
+		if len(b) < 4 {
+			break
+		}
+
+		h, ok := parseMP3Header(b)
+		if ok && info != nil && (h.sampleRate != int(wav.SampleRate) || h.channels() != int(wav.NumChannels)) {
+			// a false sync, or a stream that changes its format midway
+			ok = false
+		}
+		if !ok {
+			if tag, _ := cr.Peek(129); len(tag) == 128 && string(tag[:3]) == "TAG" {
+				// an ID3v1 tag at the very end
+				parseID3v1(wav, tag)
+				break
+			}
+
+			// look for the next frame
+			if err := cr.skip(1); err != nil {
+				break
+			}
+			continue
+		}
+
+		size := h.frameSize()
+		if info != nil && (options.HeaderOnly || wav.spanDone()) {
+			// only the first frame is needed, the others are counted; so are
+			// the frames after the span
+			if err := cr.skip(int64(size)); err != nil {
+				break
+			}
+			if h.bitrate != bitrate {
+				info.VBR = true
+			}
+			frames++
+			decoded += int64(samplesPerFrame)
+			continue
+		}
+
+		if cap(frame) < size {
+			frame = make([]byte, 0, size)
+		}
+		frame = frame[:size]
+		if _, err := io.ReadFull(cr, frame); err != nil {
+			// a truncated last frame
+			break
+		}
+
+		if info == nil {
+			info = &MP3Info{Version: h.version}
+			wav.NumChannels = int16(h.channels())
+			wav.SampleRate = int32(h.sampleRate)
+			if !options.HeaderOnly {
+				wav.Data = make([][]float32, wav.NumChannels)
+				block = make([][]float32, wav.NumChannels)
+			}
+			wav.MP3 = info
+			bitrate = h.bitrate
+			samplesPerFrame = h.samplesPerFrame()
+			wav.selectSpan(options)
+			if err := wav.selectChannel(options); err != nil {
+				return fmt.Errorf("parse error: %w", err)
+			}
+
+			// the first frame can hold a Xing or VBRI header instead of audio
+			if parseXing(frame, h, info) {
+				gapless = info.Encoder != ""
+				if gapless {
+					keepFrom = int64(info.EncoderDelay + mp3DecoderDelay)
+					if length := info.Frames*int64(samplesPerFrame) - int64(info.EncoderDelay+info.Padding); length >= 0 {
+						keepTo = keepFrom + length
+					}
+				}
+
+				// with the number of frames known, ParseHeader can
+				// skip straight to the end
+				if options.HeaderOnly && info.Frames > 0 && skipMP3Frames(cr, wav) {
+					frames = info.Frames
+					break
+				}
+				continue
+			}
+		}
+
+		if h.bitrate != bitrate {
+			info.VBR = true
+		}
+
+		if options.HeaderOnly {
+			frames++
+			continue
+		}
+		for ch := range block {
+			block[ch] = block[ch][:0]
+		}
+		if wav.Span != nil && decoded+int64((mp3WarmUpFrames+1)*samplesPerFrame) <= keepFrom+wav.Span.Start {
+			// well before the span, only the bit reservoir is kept
+			block = decoder.skipFrame(frame, h, block)
+		} else {
+			block = decoder.decodeFrame(frame, h, block)
+		}
+		wav.appendSamples(trimSamples(block, decoded, keepFrom, keepTo))
+		decoded += int64(len(block[0]))
+	}
+
+	if info == nil {
+		return fmt.Errorf("parse error: no MPEG audio frames found")
+	}
+
+	if options.HeaderOnly {
+		decoded = frames * int64(samplesPerFrame)
+	}
+	if gapless {
+		// the delay and padding were trimmed while decoding
+		if keepTo < 0 || keepTo > decoded {
+			keepTo = decoded
+		}
+		if keepFrom > keepTo {
+			keepFrom = keepTo
+		}
+		decoded = keepTo - keepFrom
+	}
+
+	wav.SampleLength = decoded
+	wav.Subchunk2Size = cr.offset - start
+	wav.ChunkSize = cr.offset - 8
+	if decoded > 0 {
+		// the average rate of the stream
+		wav.ByteRate = int32(wav.Subchunk2Size * int64(wav.SampleRate) / decoded)
+	}
+
+	return nil
+}
+
+// mp3WarmUpFrames is the number of frames decoded before the span, which
+// bring the state of the filter banks, carried over from frame to frame, up
+// to where it would be had all of the frames been decoded.
+const mp3WarmUpFrames = 2
+
+// skipMP3Frames skips the rest of the stream but for the ID3v1 tag that can
+// end it, reporting false when the reader can't seek.
+func skipMP3Frames(cr *chunkReader, wav *Wav) bool {
+	n, ok := cr.remaining()
+	if !ok {
+		return false
+	}
+
+	if n >= 128 {
+		if err := cr.skip(n - 128); err != nil {
+			return false
+		}
+		if tag, _ := cr.Peek(128); len(tag) == 128 && string(tag[:3]) == "TAG" {
+			parseID3v1(wav, tag)
+		}
+	}
+	_, _ = cr.skipToEnd()
+
+	return true
+}
+
+// parseXing reads the Xing (or Info) and VBRI headers found in the first
+// frame of many streams, reporting whether the frame holds one.
+func parseXing(frame []byte, h mp3Header, info *MP3Info) bool {
+	// the Xing header comes right after the side information
+	offset := 4 + h.sideInfoSize()
+	if h.protected {
+		offset += 2
+	}
+
+	if len(frame) >= offset+8 {
+		if tag := string(frame[offset : offset+4]); tag == "Xing" || tag == "Info" {
+			// "Info" is written by encoders for constant bitrate streams
+			info.VBR = tag == "Xing"
+
+			flags := binary.BigEndian.Uint32(frame[offset+4:])
+			pos := offset + 8
+			if flags&1 != 0 && len(frame) >= pos+4 {
+				info.Frames = int64(binary.BigEndian.Uint32(frame[pos:]))
+				pos += 4
+			}
+			if flags&2 != 0 {
+				pos += 4 // stream size
+			}
+			if flags&4 != 0 {
+				pos += 100 // seek table
+			}
+			if flags&8 != 0 {
+				pos += 4 // quality
+			}
+
+			// the LAME tag extends the Xing header with the encoder's
+			// version and the delay and padding it added
+			if len(frame) >= pos+24 && info.Frames > 0 {
+				encoder := string(frame[pos : pos+9])
+				if strings.HasPrefix(encoder, "LAME") || strings.HasPrefix(encoder, "Lavc") || strings.HasPrefix(encoder, "Lavf") {
+					info.Encoder = strings.TrimRight(strings.TrimSpace(encoder), "\x00")
+					info.EncoderDelay = int(frame[pos+21])<<4 | int(frame[pos+22])>>4
+					info.Padding = int(frame[pos+22]&0xF)<<8 | int(frame[pos+23])
+				}
+			}
+
+			return true
+		}
+	}
+
+	// the VBRI header, written by the Fraunhofer encoder, is always 32
+	// bytes after the frame header
+	if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+		info.VBR = true
+		info.Frames = int64(binary.BigEndian.Uint32(frame[36+14:]))
+
+		return true
+	}
+
+	return false
+}
+
+// parseID3v1 reads the fixed-size tag that can end MP3 files; the ID3v2
+// tags, which are read first, take precedence.
+func parseID3v1(wav *Wav, tag []byte) {
+	fields := []struct {
+		key        string
+		start, end int
+	}{
+		{"title", 3, 33},
+		{"artist", 33, 63},
+		{"album", 63, 93},
+		{"date", 93, 97},
+		{"comment", 97, 127},
+	}
+
+	// ID3v1.1 stores the track number in the last two bytes of the comment
+	if tag[125] == 0 && tag[126] != 0 {
+		fields[4].end = 125
+		if _, ok := wav.Metadata["track"]; !ok {
+			wav.setMetadata("track", fmt.Sprint(tag[126]))
+		}
+	}
+
+	for _, f := range fields {
+		if _, ok := wav.Metadata[f.key]; ok {
+			continue
+		}
+
+		value := tag[f.start:f.end]
+		if i := bytes.IndexByte(value, 0); i >= 0 {
+			value = value[:i]
+		}
+		wav.setMetadata(f.key, decodeID3String(value, 0))
+	}
+}
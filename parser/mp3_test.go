@@ -0,0 +1,211 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+)
+
+// mp3FrameHeader is an MPEG-1 Layer III header for 128 kbps mono at 44.1 kHz,
+// which makes frames of 417 bytes.
+var mp3FrameHeader = []byte{0xFF, 0xFB, 0x90, 0xC0}
+
+const mp3FrameSize = 417
+
+// id3Frame builds an ID3v2.3 frame.
+func id3Frame(id string, content []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	_ = binary.Write(&b, binary.BigEndian, uint32(len(content)))
+	b.Write([]byte{0, 0})
+	b.Write(content)
+
+	return b.Bytes()
+}
+
+func TestDecodingMP3(t *testing.T) {
+	var stream bytes.Buffer
+
+	// an ID3v2.3 tag, with a Latin-1 title and a user defined UTF-8 field
+	frames := append(id3Frame("TIT2", []byte("\x00Episode \xe9")), id3Frame("TXXX", []byte("\x03PODCAST\x00yes"))...)
+	stream.WriteString("ID3\x03\x00\x00")
+	stream.Write([]byte{0, 0, byte(len(frames) >> 7), byte(len(frames) & 0x7F)})
+	stream.Write(frames)
+
+	// an Info frame, with a LAME tag giving the stream 3 frames, an encoder
+	// delay of 576 samples and a padding of 1000 samples
+	info := make([]byte, mp3FrameSize)
+	copy(info, mp3FrameHeader)
+	copy(info[4+17:], "Info\x00\x00\x00\x01\x00\x00\x00\x03LAME3.100")
+	copy(info[4+17+12+21:], []byte{0x24, 0x03, 0xE8})
+	stream.Write(info)
+
+	// three frames whose first granule holds a single spectral value
+	var sideInfo bitWriter
+	sideInfo.write(0, 9+5+4) // no main data in the reservoir, no scfsi
+	sideInfo.write(3, 12)    // part2_3_length
+	sideInfo.write(1, 9)     // a single pair of big values
+	sideInfo.write(210, 8)   // a global gain of 1
+	sideInfo.write(0, 4+1)   // no scalefactors, a long block
+	sideInfo.write(1, 5)     // table 1 for the first region
+	sideInfo.write(0, 5+5+4+3+3)
+	sideInfo.write(0, 59) // an empty second granule
+
+	audio := make([]byte, mp3FrameSize)
+	copy(audio, mp3FrameHeader)
+	copy(audio[4:], sideInfo.buf)
+	audio[4+17] = 0x40 // the code for (1, 0), and a positive sign
+	for i := 0; i < 3; i++ {
+		stream.Write(audio)
+	}
+
+	// an ID3v1 tag, whose title is superseded by the ID3v2 one
+	v1 := make([]byte, 128)
+	copy(v1, "TAGOther")
+	copy(v1[33:], "Host")
+	stream.Write(v1)
+
+	for _, options := range []Options{{}, {PeaksOnly: true}, {HeaderOnly: true}} {
+		wav, err := ParseWithOptions(bytes.NewReader(stream.Bytes()), options)
+		if err != nil {
+			t.Fatalf("failed parsing: %v", err)
+		}
+		if err := wav.CheckFormat(); err != nil {
+			t.Fatalf("validation failed: %v", err)
+		}
+
+		if wav.SampleRate != 44100 || wav.NumChannels != 1 || wav.GetEncodingName() != "MPEG-1 Layer III" {
+			t.Errorf("unexpected format: %d Hz, %d channels, %s", wav.SampleRate, wav.NumChannels, wav.GetEncodingName())
+		}
+		if wav.MP3.Encoder != "LAME3.100" || wav.MP3.Frames != 3 || wav.MP3.VBR {
+			t.Errorf("unexpected stream info: %+v", *wav.MP3)
+		}
+
+		// the encoder delay and padding are trimmed
+		if n := wav.GetNumSamples(); n != 3*1152-576-1000 {
+			t.Errorf("expected %d samples, got %d", 3*1152-576-1000, n)
+		}
+
+		if wav.Metadata["title"] != "Episode é" || wav.Metadata["podcast"] != "yes" || wav.Metadata["artist"] != "Host" {
+			t.Errorf("unexpected metadata: %v", wav.Metadata)
+		}
+
+		if options.HeaderOnly {
+			if wav.Data != nil {
+				t.Errorf("expected no samples to be decoded")
+			}
+			continue
+		}
+		if len(wav.Data[0]) != int(wav.GetNumSamples()) {
+			t.Errorf("expected %d samples, decoded %d", wav.GetNumSamples(), len(wav.Data[0]))
+		}
+
+		var peak float32
+		for _, s := range wav.Data[0] {
+			if s > peak {
+				peak = s
+			} else if -s > peak {
+				peak = -s
+			}
+		}
+		if peak == 0 || peak > 1 {
+			t.Errorf("peaks only %v: unexpected peak %v", options.PeaksOnly, peak)
+		}
+	}
+}
+
+// TestDecodingMP3Excerpt checks the decoder against go-mp3 on 64 frames of
+// MPEG-2 speech, cut out of the public domain example of its repository,
+// along with the PCM that go-mp3 decodes them to, in 16 bits.
+func TestDecodingMP3Excerpt(t *testing.T) {
+	mp3, err := os.ReadFile("../test-files/1ch-22050-mpeg2.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm, err := os.ReadFile("../test-files/1ch-22050-mpeg2-decoded.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wav, err := Parse(bytes.NewReader(mp3))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	reference, err := Parse(bytes.NewReader(pcm))
+	if err != nil {
+		t.Fatalf("failed parsing the reference: %v", err)
+	}
+	if len(wav.Data[0]) != 64*576 || len(reference.Data[0]) != len(wav.Data[0]) {
+		t.Fatalf("expected %d samples, given %d and %d in the reference", 64*576, len(wav.Data[0]), len(reference.Data[0]))
+	}
+
+	// the first frames depend on the main data and the filter states of the
+	// frames that were cut off, which the decoders make up differently
+	const from = 3 * 576
+	for i := from; i < len(wav.Data[0]); i++ {
+		if d := math.Abs(float64(wav.Data[0][i] - reference.Data[0][i])); d > 2.0/32768 {
+			t.Fatalf("sample %d: expected %f, given %f", i, reference.Data[0][i], wav.Data[0][i])
+		}
+	}
+
+	// the levels estimated from the spectra hold the energy of the samples
+	peaks, err := ParseWithOptions(bytes.NewReader(mp3), Options{PeaksOnly: true})
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	var energy, estimated float64
+	for i := from; i < len(wav.Data[0]); i++ {
+		energy += float64(wav.Data[0][i]) * float64(wav.Data[0][i])
+		// the levels are the peaks of sine waves, √2 times their RMS level
+		estimated += float64(peaks.Data[0][i]) * float64(peaks.Data[0][i]) / 2
+	}
+	if ratio := math.Sqrt(estimated / energy); ratio < 0.98 || ratio > 1.02 {
+		t.Errorf("expected the estimated levels to match the decoded ones, given a ratio of %f", ratio)
+	}
+}
+
+// TestDecodingMP3JointStereo checks the decoder against minimp3 on 20 frames
+// of MPEG-1 joint stereo, generated with random spectra to go through the
+// paths encoders of speech rarely take: middle/side and intensity stereo,
+// alone and together, start, short, mixed and stop blocks, shared
+// scalefactors and main data starting up to 511 bytes back. go-mp3 doesn't
+// follow the standard for intensity stereo, and minimp3 windows the overlap
+// of the long subbands of mixed blocks with the window of the next granule,
+// so the granules on either side of a change to or from mixed blocks leave
+// their lowest subbands silent.
+func TestDecodingMP3JointStereo(t *testing.T) {
+	mp3, err := os.ReadFile("../test-files/2ch-48000-mpeg1-joint.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm, err := os.ReadFile("../test-files/2ch-48000-mpeg1-joint-decoded.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wav, err := Parse(bytes.NewReader(mp3))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	reference, err := Parse(bytes.NewReader(pcm))
+	if err != nil {
+		t.Fatalf("failed parsing the reference: %v", err)
+	}
+	if wav.NumChannels != 2 || wav.SampleRate != 48000 || wav.GetEncodingName() != "MPEG-1 Layer III" {
+		t.Fatalf("unexpected format: %d Hz, %d channels, %s", wav.SampleRate, wav.NumChannels, wav.GetEncodingName())
+	}
+	if len(wav.Data[0]) != 20*1152 || len(reference.Data[0]) != len(wav.Data[0]) {
+		t.Fatalf("expected %d samples, given %d and %d in the reference", 20*1152, len(wav.Data[0]), len(reference.Data[0]))
+	}
+
+	// the stream starts from scratch, so the first frames match too
+	for ch := range wav.Data {
+		for i := range wav.Data[ch] {
+			if d := math.Abs(float64(wav.Data[ch][i] - reference.Data[ch][i])); d > 2.0/32768 {
+				t.Fatalf("sample %d on channel %d: expected %f, given %f", i, ch, reference.Data[ch][i], wav.Data[ch][i])
+			}
+		}
+	}
+}
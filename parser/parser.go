@@ -1,224 +1,841 @@
 package parser
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math"
-	"os"
+	"time"
 )
 
+// Format tags, as found in the fmt chunk's AudioFormat field or in the first
+// two bytes of the SubFormat GUID for WAVE_FORMAT_EXTENSIBLE files.
+const (
+	FormatPCM        uint16 = 0x0001
+	FormatMSADPCM    uint16 = 0x0002
+	FormatIEEEFloat  uint16 = 0x0003
+	FormatALaw       uint16 = 0x0006
+	FormatMuLaw      uint16 = 0x0007
+	FormatIMAADPCM   uint16 = 0x0011
+	FormatMPEGLayer3 uint16 = 0x0055 // only used for MP3 streams
+	FormatFLAC       uint16 = 0xF1AC // only used for native FLAC streams
+	FormatExtensible uint16 = 0xFFFE
+)
+
+// subFormatSuffix is the part shared by all the KSDATAFORMAT_SUBTYPE GUIDs
+// derived from a format tag, following the tag itself.
+var subFormatSuffix = [14]byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+// unknownSize is the chunk size used by streamed files, which can't go back and
+// fill in the real size, and by RF64 files, where the real size is in ds64.
+const unknownSize = 0xFFFFFFFF
+
+// ds64 holds the 64-bit sizes of an RF64/BW64 file.
+type ds64 struct {
+	riffSize int64
+	dataSize int64
+	table    map[string]int64
+}
+
 type Wav struct {
 	Name          string
 	ChunkID       [4]byte
-	ChunkSize     int32
+	ChunkSize     int64
 	Format        [4]byte
 	Subchunk1ID   [4]byte
 	Subchunk1Size int32
-	AudioFormat   int16
+	AudioFormat   uint16
 	NumChannels   int16
 	SampleRate    int32
 	ByteRate      int32
 	BlockAlign    int16
 	BitsPerSample int16
+
+	// fields only present in the WAVE_FORMAT_EXTENSIBLE fmt chunk
+	ExtensionSize      int16
+	ValidBitsPerSample int16
+	ChannelMask        uint32
+	SubFormat          [16]byte
+
+	// fields only present in the ADPCM fmt chunks
+	SamplesPerBlock int16
+	Coefficients    [][2]int16 // MS ADPCM only
+
+	// number of samples per channel, from the fact chunk of compressed files
+	SampleLength int64
+
+	// tags from the LIST/INFO chunk, like "title", "artist" or "comment"
+	Metadata map[string]string
+
+	// the bext chunk of Broadcast Wave files, if any
+	Bext *BroadcastExtension
+
+	// the production metadata of the iXML chunk, and the XML document of
+	// the axml chunk, if any
+	IXML *IXML
+	AXML string
+
+	// the peak of each channel, from the PEAK chunk, if any
+	PeakChunk *PeakChunk
+
+	// the images attached to ID3v2 tags, like cover art
+	Pictures []Picture
+
+	// cue points and regions, sorted by their offset
+	Markers []Marker
+
+	// the smpl and inst chunks, used by samplers
+	Sampler    *Sampler
+	Instrument *Instrument
+
+	// the STREAMINFO fields of FLAC streams
+	Flac *FlacStreamInfo
+
+	// the properties of MP3 streams
+	MP3 *MP3Info
+
+	// how the samples are stored, set by the container parsers: WAVE files
+	// have little-endian samples (big-endian in RIFX files) that are unsigned if
+	// 8-bit and signed otherwise
+	ByteOrder binary.ByteOrder
+	Signed    bool
+
 	Subchunk2ID   [4]byte
-	Subchunk2Size int32
-	Data          [][]int16
+	Subchunk2Size int64
+	Data          [][]float32 // normalized samples, one slice per channel
+
+	// the reduced samples, when parsing with Options.Buckets
+	Peaks *Peaks
+
+	// the samples that were decoded, when parsing with Options.Start or
+	// Options.End, see GetSpan
+	Span     *Span
+	position int64 // of the next samples handed to appendSamples
+
+	// the channel Peaks are reduced from, counted from 1, when parsing with
+	// Options.Channel; 0 when all of them are mixed down
+	SelectedChannel int
+
+	// the errors that parsing with Options.Lenient got past
+	Problems []error
 }
 
-func readSample(r io.Reader, sampleSize int, audioFormat *int16) (int16, error) {
-	if sampleSize == 8 {
-		var sample uint8
-		err := binary.Read(r, binary.LittleEndian, &sample)
-		if err != nil {
-			return int16(0), err
-		}
+// sampleFormat describes the layout of a single sample.
+type sampleFormat struct {
+	size      int // in bits
+	code      uint16
+	byteOrder binary.ByteOrder
+	signed    bool
+}
 
-		return scaleToInt16(sample), nil
-	} else if sampleSize == 16 {
-		var sample int16
-		err := binary.Read(r, binary.LittleEndian, &sample)
-		if err != nil {
-			return int16(0), err
-		}
+// byteOrder returns the byte order of the samples and, in WAVE files, of
+// the chunk headers and fields, which are big-endian in RIFX files only.
+func (w *Wav) byteOrder() binary.ByteOrder {
+	if w.ByteOrder == nil {
+		return binary.LittleEndian
+	}
 
-		return scaleToInt16(sample), nil
-	} else if sampleSize == 24 {
-		sample, err := read24BitSample(r)
-		if err != nil {
-			return int16(0), err
+	return w.ByteOrder
+}
+
+func (w *Wav) getSampleFormat() sampleFormat {
+	return sampleFormat{
+		size:      int(w.BitsPerSample),
+		code:      w.GetFormatCode(),
+		byteOrder: w.byteOrder(),
+		signed:    w.Signed,
+	}
+}
+
+// sampleDecoder returns a function that reads a single sample from the start
+// of b and normalizes it to the [-1, 1) range, dividing the integer formats by
+// the magnitude of their most negative value; unsigned samples are centered on
+// 0 first.
+func sampleDecoder(f sampleFormat) (func(b []byte) float32, error) {
+	byteOrder := f.byteOrder
+
+	switch {
+	case f.size == 8 && f.code == FormatALaw:
+		return func(b []byte) float32 {
+			return float32(alawToLinear(b[0])) / (1 << 15)
+		}, nil
+	case f.size == 8 && f.code == FormatMuLaw:
+		return func(b []byte) float32 {
+			return float32(mulawToLinear(b[0])) / (1 << 15)
+		}, nil
+	case f.size == 8 && f.signed:
+		return func(b []byte) float32 {
+			return float32(int8(b[0])) / (1 << 7)
+		}, nil
+	case f.size == 8:
+		return func(b []byte) float32 {
+			return float32(int16(b[0])-128) / (1 << 7)
+		}, nil
+	case f.size == 16:
+		// flipping the sign bit turns offset binary into two's complement
+		var flip uint16
+		if !f.signed {
+			flip = 1 << 15
 		}
+		return func(b []byte) float32 {
+			return float32(int16(byteOrder.Uint16(b)^flip)) / (1 << 15)
+		}, nil
+	case f.size == 24:
+		var flip int32
+		if !f.signed {
+			flip = -1 << 23
+		}
+		return func(b []byte) float32 {
+			return float32(int24(b, byteOrder)^flip) / (1 << 23)
+		}, nil
+	case f.size == 32 && f.code == FormatPCM:
+		var flip uint32
+		if !f.signed {
+			flip = 1 << 31
+		}
+		return func(b []byte) float32 {
+			return float32(float64(int32(byteOrder.Uint32(b)^flip)) / (1 << 31))
+		}, nil
+	case f.size == 32 && f.code == FormatIEEEFloat:
+		return func(b []byte) float32 {
+			return math.Float32frombits(byteOrder.Uint32(b))
+		}, nil
+	case f.size == 64 && f.code == FormatIEEEFloat:
+		return func(b []byte) float32 {
+			return float32(math.Float64frombits(byteOrder.Uint64(b)))
+		}, nil
+	default:
+		return nil, errors.New("invalid sample size")
+	}
+}
 
-		return scaleToInt16(sample), nil
-	} else if sampleSize == 32 && *audioFormat == 1 { // PCM
-		var sample int32
-		err := binary.Read(r, binary.LittleEndian, &sample)
-		if err != nil {
-			return int16(0), err
+// Options changes how Parse decodes a stream.
+type Options struct {
+	// PeaksOnly makes the MP3 decoder estimate the level of each granule
+	// from its spectrum instead of synthesizing the samples, which is much
+	// faster and good enough for drawing waveforms
+	PeaksOnly bool
+
+	// HeaderOnly skips the samples, leaving Data empty, see ParseHeader
+	HeaderOnly bool
+
+	// Buckets, if set, reduces the samples to at most that many buckets in
+	// Peaks as they're decoded, instead of keeping them in Data, so that
+	// memory stays bounded however long the stream is
+	Buckets int
+
+	// Lenient salvages what can be read of damaged WAVE, Wave64, AIFF and
+	// CAF files: the samples of a truncated data chunk are kept, and the
+	// chunks that can't be read are skipped, with the errors listed in
+	// Wav.Problems
+	Lenient bool
+
+	// Start and End select the part of the stream between those times, the
+	// end of the stream if End is 0: only its samples are decoded, the ones
+	// before it being skipped by seeking where the format allows, and its
+	// position is kept in Wav.Span
+	Start time.Duration
+	End   time.Duration
+
+	// Channel, if set, reduces only that channel into Peaks instead of all
+	// of them mixed down; it's given by its number from 1, its speaker
+	// position, like "LFE", or its iXML track name, see Wav.FindChannel
+	Channel string
+}
+
+// Parse decodes an audio stream read from r, detecting its format from its
+// contents; WAVE (including RIFX and RF64/BW64), Wave64, AIFF/AIFF-C, CAF,
+// FLAC and MP3 are supported. When r is also an io.Seeker, the chunks that
+// aren't needed are skipped by seeking instead of being read.
+func Parse(r io.Reader) (*Wav, error) {
+	return ParseWithOptions(r, Options{})
+}
+
+// ParseHeader reads the format, the duration and the metadata of a stream
+// without decoding its samples, which are skipped by seeking when r is an
+// io.Seeker. Data is left empty, and the FLAC MD5 signature isn't checked.
+func ParseHeader(r io.Reader) (*Wav, error) {
+	return ParseWithOptions(r, Options{HeaderOnly: true})
+}
+
+// ParseWithOptions is like Parse, with options.
+func ParseWithOptions(r io.Reader, options Options) (*Wav, error) {
+	if err := checkRange(options); err != nil {
+		return nil, err
+	}
+
+	var wav Wav
+	if n, ok := r.(interface{ Name() string }); ok {
+		wav.Name = n.Name()
+	}
+
+	if options.Buckets > 0 && !options.HeaderOnly {
+		wav.Peaks = newPeaks(options.Buckets)
+	}
+
+	cr := newChunkReader(r)
+
+	magic, err := cr.Peek(4)
+	if len(magic) == 0 {
+		return nil, fmt.Errorf("%w: empty input", ErrUnrecognized)
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnrecognized, err)
+	}
+
+	// ID3v2 tags are prepended to MP3 and sometimes to FLAC streams
+	for bytes.HasPrefix(magic, []byte("ID3")) {
+		if err := parseID3(cr, &wav); err != nil {
+			return nil, fmt.Errorf("parse error: %w", err)
 		}
 
-		return scaleToInt16(sample), nil
-	} else if sampleSize == 32 && *audioFormat == 3 { // IEEE_FLOAT
-		var sample float32
-		err := binary.Read(r, binary.LittleEndian, &sample)
-		if err != nil {
-			return int16(0), err
+		if magic, err = cr.Peek(4); len(magic) < 4 {
+			return nil, fmt.Errorf("%w: no audio after the ID3 tag", ErrUnrecognized)
 		}
+	}
 
-		return scaleToInt16(sample), nil
-	} else if sampleSize == 64 && *audioFormat == 3 { // IEEE_FLOAT
-		var sample float64
-		err := binary.Read(r, binary.LittleEndian, &sample)
-		if err != nil {
-			return int16(0), err
+	switch string(magic) {
+	case "RIFF", "RIFX", "RF64", "BW64":
+		err = parseWave(cr, &wav, options)
+	case "riff":
+		err = parseW64(cr, &wav, options)
+	case "FORM":
+		err = parseAiff(cr, &wav, options)
+	case "caff":
+		err = parseCaf(cr, &wav, options)
+	case "fLaC":
+		err = parseFlac(cr, &wav, options)
+	default:
+		if _, ok := parseMP3Header(magic); !ok {
+			return nil, fmt.Errorf("%w: %q is not a known file signature", ErrUnrecognized, magic)
 		}
+		err = parseMP3(cr, &wav, options)
+	}
+	if err != nil {
+		return nil, channelError(err)
+	}
+	if err := wav.closeSpan(); err != nil {
+		return nil, err
+	}
 
-		return scaleToInt16(sample), nil
-	} else {
-		return int16(0), errors.New("invalid sample size")
+	wav.sortMarkers()
+	if wav.Peaks != nil {
+		wav.Peaks.finish()
 	}
+
+	return &wav, nil
 }
 
-func Parse(f *os.File) (*Wav, error) {
-	var wav Wav
-	wav.Name = f.Name()
+func parseWave(cr *chunkReader, wav *Wav, options Options) error {
+	wav.ByteOrder = binary.LittleEndian
+	if magic, _ := cr.Peek(4); string(magic) == "RIFX" {
+		// everything but the chunk IDs is big-endian
+		wav.ByteOrder = binary.BigEndian
+	}
 
-	r := bufio.NewReader(f)
+	// set for RF64/BW64 files, once the ds64 chunk is read
+	var sizes *ds64
+	var err error
 
 	for {
+		offset := cr.offset
+
 		var chunkID [4]byte
-		var chunkSize int32
-		if err := binary.Read(r, binary.BigEndian, &chunkID); err != nil {
+		var chunkSize uint32
+		if err := binary.Read(cr, binary.BigEndian, &chunkID); err != nil {
 			if err == io.EOF {
 				break
 			}
-			return nil, fmt.Errorf("failed reading the chunk ID: %v", err)
+			if err := wav.salvage(fmt.Errorf("failed reading the chunk ID: %w", truncated(err)), options); err != nil {
+				return err
+			}
+			break
 		}
-		if err := binary.Read(r, binary.LittleEndian, &chunkSize); err != nil {
+		if err := binary.Read(cr, wav.ByteOrder, &chunkSize); err != nil {
 			if err == io.EOF {
 				break
 			}
-			return nil, fmt.Errorf("failed reading the chunk size: %v", err)
+			if err := wav.salvage(fmt.Errorf("failed reading the chunk size: %w", truncated(err)), options); err != nil {
+				return err
+			}
+			break
 		}
 
 		chunkIDStr := string(chunkID[:])
+		size := int64(chunkSize)
 
-		if chunkIDStr == "RIFF" {
-			wav.ChunkID = chunkID
-			wav.ChunkSize = chunkSize
-
-			if err := binary.Read(r, binary.BigEndian, &wav.Format); err != nil {
-				return nil, fmt.Errorf("parse error: %v", err)
+		if chunkSize == unknownSize && sizes != nil {
+			if chunkIDStr == "data" {
+				size = sizes.dataSize
+			} else if s, ok := sizes.table[chunkIDStr]; ok {
+				size = s
 			}
-		} else if chunkIDStr == "fmt " {
-			wav.Subchunk1ID = chunkID
-			wav.Subchunk1Size = chunkSize
+		}
 
-			if err := binary.Read(r, binary.LittleEndian, &wav.AudioFormat); err != nil {
-				return nil, fmt.Errorf("parse error: %v", err)
-			}
-			if err := binary.Read(r, binary.LittleEndian, &wav.NumChannels); err != nil {
-				return nil, fmt.Errorf("parse error: %v", err)
+		isHeader := wav.ChunkID == [4]byte{}
+
+		if isHeader {
+			wav.ChunkID = chunkID
+			wav.ChunkSize = size
+
+			if err := binary.Read(cr, binary.BigEndian, &wav.Format); err != nil {
+				return chunkError(chunkIDStr, offset, err)
 			}
-			if err := binary.Read(r, binary.LittleEndian, &wav.SampleRate); err != nil {
-				return nil, fmt.Errorf("parse error: %v", err)
+			if string(wav.Format[:]) != "WAVE" {
+				return fmt.Errorf("%w: not a WAVE file", ErrUnrecognized)
 			}
-			if err := binary.Read(r, binary.LittleEndian, &wav.ByteRate); err != nil {
-				return nil, fmt.Errorf("parse error: %v", err)
+			continue
+		}
+
+		// the last chunk of a truncated file is read as far as it goes
+		last := false
+		if options.Lenient {
+			size, last = clampChunkSize(cr, wav, chunkIDStr, offset, size)
+		}
+
+		if chunkIDStr == "ds64" {
+			if sizes, err = parseDs64(cr, size); err != nil {
+				return chunkError(chunkIDStr, offset, err)
 			}
-			if err := binary.Read(r, binary.LittleEndian, &wav.BlockAlign); err != nil {
-				return nil, fmt.Errorf("parse error: %v", err)
+			if wav.ChunkSize == unknownSize {
+				wav.ChunkSize = sizes.riffSize
 			}
-			if err := binary.Read(r, binary.LittleEndian, &wav.BitsPerSample); err != nil {
-				return nil, fmt.Errorf("parse error: %v", err)
+		} else if err := parseWaveChunk(cr, wav, chunkID, size, options); err != nil {
+			if err := wav.salvage(chunkError(chunkIDStr, offset, err), options); err != nil {
+				return err
 			}
-			// 16 bytes consumed from this chunk so far;
-			// discard the remaining bytes, if any
-			remainingBytes := chunkSize - int32(16)
-			if remainingBytes > 0 {
-				discarded := make([]byte, remainingBytes)
-				if err := binary.Read(r, binary.BigEndian, &discarded); err != nil {
-					return nil, fmt.Errorf("parse error: %v", err)
-				}
+			if !skipPastChunk(cr, offset+8+size) {
+				break
 			}
-		} else if chunkIDStr == "data" {
-			wav.Subchunk2ID = chunkID
-			wav.Subchunk2Size = chunkSize
+		}
 
-			if err := parseData(r, &wav); err != nil {
-				return nil, fmt.Errorf("parse error: %v", err)
-			}
-		} else {
-			// discarding chunks (that may or may not be present), like "PEAK", "fact", etc
-			discarded := make([]byte, chunkSize)
+		if last {
+			break
+		}
 
-			if err := binary.Read(r, binary.BigEndian, &discarded); err != nil {
-				return nil, fmt.Errorf("parse error: %v", err)
+		// chunks are word aligned, so the odd-sized ones (like inst, which is
+		// always 7 bytes long) are followed by a pad byte
+		if size%2 == 1 {
+			if err := cr.skip(1); err != nil && err != io.ErrUnexpectedEOF {
+				return fmt.Errorf("parse error: %w", err)
 			}
 		}
 	}
 
-	return &wav, nil
+	if wav.Subchunk1ID == [4]byte{} {
+		return fmt.Errorf("parse error: %w", ErrMissingFmt)
+	}
+
+	if wav.ChunkSize == unknownSize {
+		// streamed file, see parseData
+		wav.ChunkSize = cr.offset - 8
+	}
+
+	return nil
+}
+
+// parseWaveChunk reads a chunk of a WAVE file, or of a Wave64 file once its
+// GUID is mapped to the matching chunk ID, after its header.
+func parseWaveChunk(cr *chunkReader, wav *Wav, chunkID [4]byte, size int64, options Options) error {
+	chunkIDStr := string(chunkID[:])
+
+	if size < 0 {
+		return ErrChunkSize
+	}
+
+	if chunkIDStr == "fmt " {
+		wav.Subchunk1ID = chunkID
+		wav.Subchunk1Size = int32(size)
+
+		if err := parseFmt(cr, wav, size); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "fact" {
+		if size < 4 {
+			return ErrChunkSize
+		}
+
+		var sampleLength uint32
+		if err := binary.Read(cr, wav.byteOrder(), &sampleLength); err != nil {
+			return err
+		}
+		wav.SampleLength = int64(sampleLength)
+
+		if err := cr.skip(size - 4); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "LIST" {
+		if err := parseList(cr, wav, size); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "cue " {
+		if err := parseCue(cr, wav, size); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "smpl" {
+		if err := parseSmpl(cr, wav, size); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "inst" {
+		if err := parseInst(cr, wav, size); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "bext" {
+		if err := parseBext(cr, wav, size); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "PEAK" {
+		if err := parsePeak(cr, wav, size, wav.byteOrder()); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "iXML" {
+		if err := parseIXML(cr, wav, size); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "axml" {
+		if err := parseAXML(cr, wav, size); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "id3 " || chunkIDStr == "ID3 " {
+		if err := parseID3Chunk(cr, wav, size); err != nil {
+			return err
+		}
+	} else if chunkIDStr == "data" {
+		if wav.Subchunk1ID == [4]byte{} {
+			return ErrMissingFmt
+		}
+
+		wav.Subchunk2ID = chunkID
+		wav.Subchunk2Size = size
+
+		if err := readData(cr, wav, options); err != nil {
+			return err
+		}
+	} else {
+		// discarding chunks (that may or may not be present), like "acid", etc
+		if err := cr.skip(size); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func parseData(r *bufio.Reader, wav *Wav) error {
-	wav.Data = make([][]int16, wav.NumChannels)
+func parseDs64(r io.Reader, chunkSize int64) (*ds64, error) {
+	if chunkSize < 28 || chunkSize > 1<<20 {
+		return nil, fmt.Errorf("%w: ds64 chunk of %d bytes", ErrChunkSize, chunkSize)
+	}
+
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := &ds64{
+		riffSize: int64(binary.LittleEndian.Uint64(chunk[0:])),
+		dataSize: int64(binary.LittleEndian.Uint64(chunk[8:])),
+		table:    make(map[string]int64),
+	}
+
+	// chunk[16:24] holds the sample count, which is only relevant for
+	// compressed formats; the table holds the sizes of the other chunks that don't fit in 32 bits
+	tableLength := int64(binary.LittleEndian.Uint32(chunk[24:]))
+	for i, offset := int64(0), int64(28); i < tableLength && offset+12 <= chunkSize; i, offset = i+1, offset+12 {
+		sizes.table[string(chunk[offset:offset+4])] = int64(binary.LittleEndian.Uint64(chunk[offset+4:]))
+	}
+
+	return sizes, nil
+}
+
+func parseFmt(r io.Reader, wav *Wav, chunkSize int64) error {
+	if chunkSize < 16 {
+		return fmt.Errorf("%w: fmt chunk of %d bytes", ErrChunkSize, chunkSize)
+	}
+
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	br := bytes.NewReader(chunk)
+	fields := []interface{}{
+		&wav.AudioFormat,
+		&wav.NumChannels,
+		&wav.SampleRate,
+		&wav.ByteRate,
+		&wav.BlockAlign,
+		&wav.BitsPerSample,
+	}
+
+	if chunkSize >= 18 {
+		fields = append(fields, &wav.ExtensionSize)
+	}
+
+	var numCoefficients int16
+
+	byteOrder := wav.byteOrder()
+
+	switch byteOrder.Uint16(chunk) {
+	case FormatExtensible:
+		// WAVE_FORMAT_EXTENSIBLE adds 22 bytes after the cbSize field
+		if chunkSize >= 40 {
+			fields = append(fields,
+				&wav.ValidBitsPerSample,
+				&wav.ChannelMask,
+				&wav.SubFormat,
+			)
+		}
+	case FormatIMAADPCM:
+		if chunkSize >= 20 {
+			fields = append(fields, &wav.SamplesPerBlock)
+		}
+	case FormatMSADPCM:
+		// followed by the coefficient pairs
+		if chunkSize >= 22 {
+			fields = append(fields, &wav.SamplesPerBlock, &numCoefficients)
+		}
+	}
+
+	for _, field := range fields {
+		if err := binary.Read(br, byteOrder, field); err != nil {
+			return err
+		}
+	}
+
+	if byteOrder == binary.BigEndian {
+		// the GUID starts with a 32-bit and two 16-bit fields, which are
+		// swapped back so that GetFormatCode can read the format tag
+		guid := &wav.SubFormat
+		guid[0], guid[1], guid[2], guid[3] = guid[3], guid[2], guid[1], guid[0]
+		guid[4], guid[5] = guid[5], guid[4]
+		guid[6], guid[7] = guid[7], guid[6]
+	}
+
+	wav.Signed = wav.BitsPerSample > 8
+
+	if numCoefficients > 0 && int(numCoefficients)*4 <= br.Len() {
+		wav.Coefficients = make([][2]int16, numCoefficients)
+		if err := binary.Read(br, byteOrder, wav.Coefficients); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readData decodes the samples of the data chunk, or skips them when only
+// the header is needed.
+func readData(cr *chunkReader, wav *Wav, options Options) error {
+	wav.selectSpan(options)
+	if err := wav.selectChannel(options); err != nil {
+		return err
+	}
+	if err := wav.checkSamplesPerBlock(options); err != nil {
+		return err
+	}
+	if !options.HeaderOnly {
+		// a PEAK chunk that comes before the data is checked along the way
+		peak := wav.PeakChunk
+		if peak != nil && wav.Span == nil && wav.NumChannels > 0 {
+			peak.Measured = make([]PositionPeak, wav.NumChannels)
+		}
+
+		err := parseData(cr, wav)
+		if err != nil && peak != nil {
+			peak.Measured = nil
+		}
+
+		return err
+	}
+
+	if wav.Subchunk2Size != unknownSize {
+		return cr.skip(wav.Subchunk2Size)
+	}
+
+	// the data of streamed files runs until EOF, see parseData
+	n, err := cr.skipToEnd()
+	if wav.isADPCM() {
+		// the blocks decode on their own, the last one to fewer samples
+		// when it's cut short, see getADPCMNumSamples
+		wav.Subchunk2Size = n
+		return err
+	}
+	if frameSize := int64(wav.NumChannels) * int64(wav.BitsPerSample) / 8; frameSize > 0 {
+		wav.Subchunk2Size = n / frameSize * frameSize
+		if err == nil && n%frameSize != 0 {
+			err = errPartialFrame
+		}
+	}
+
+	return err
+}
+
+// dataBlockSize is roughly how many bytes parseData reads at once.
+const dataBlockSize = 1 << 16
+
+// maxPreallocatedSamples caps the number of samples per channel parseData
+// allocates up front when it can't check the data size against the size of
+// the input, so that a bogus header can't exhaust the memory.
+const maxPreallocatedSamples = 1 << 24
+
+// errPartialFrame is returned for streamed data that ends in the middle of a
+// frame, which is left out.
+var errPartialFrame = fmt.Errorf("the data ends in the middle of a frame: %w", ErrTruncated)
+
+// parseData decodes the interleaved samples of the data chunk, a block of
+// whole frames at a time.
+func parseData(cr *chunkReader, wav *Wav) error {
+	if wav.NumChannels <= 0 {
+		return fmt.Errorf("invalid channel count %d", wav.NumChannels)
+	}
+
+	wav.Data = make([][]float32, wav.NumChannels)
+
+	if wav.isADPCM() {
+		return parseADPCMData(cr, wav)
+	}
+
+	decode, err := sampleDecoder(wav.getSampleFormat())
+	if err != nil {
+		return fmt.Errorf("error reading sample: %w", err)
+	}
+
+	// a streamed file (e.g. one written to a pipe) can't go back and fill in
+	// the data size, so it's left at 0xFFFFFFFF and the data runs until EOF
+	streamed := wav.Subchunk2Size == unknownSize
 
 	numSamples := wav.GetNumSamples()
+	if streamed {
+		numSamples = math.MaxInt64
+	}
 
-	if numSamples == 0 {
+	if numSamples <= 0 {
 		// not sure when this can happen (malformed wav?), but if it happens
 		// it leads to a division by zero down the line
 		return fmt.Errorf("could not get the number of samples")
 	}
 
-	var i int16
-	for s := int32(0); s < numSamples; s++ {
-		for ; i < wav.NumChannels; i++ {
-			sample, err := readSample(r, int(wav.BitsPerSample), &wav.AudioFormat)
-			if err != nil {
-				return fmt.Errorf("error reading sample: %v", err)
+	sampleSize := int(wav.BitsPerSample) / 8
+	frameSize := sampleSize * int(wav.NumChannels)
+
+	// the frames before the span are seeked over, as each of them takes
+	// BlockAlign bytes, and the reading stops at its end
+	var s int64
+	if span := wav.Span; span != nil {
+		if span.End >= 0 && span.End < numSamples {
+			numSamples = span.End
+		}
+
+		start := span.Start
+		if start > numSamples {
+			start = numSamples
+		}
+		s, err = skipFrames(cr, start, int64(frameSize))
+		wav.position = s
+		if err != nil && !streamed {
+			wav.Subchunk2Size = s * int64(frameSize)
+			return fmt.Errorf("error reading sample: %w", truncated(err))
+		}
+	}
+
+	if wav.Peaks == nil {
+		capacity := numSamples - s
+		if remaining, ok := cr.remaining(); ok {
+			if frames := remaining / int64(frameSize); frames < capacity {
+				capacity = frames
 			}
+		} else if capacity > maxPreallocatedSamples {
+			capacity = maxPreallocatedSamples
+		}
+		if capacity < 0 {
+			capacity = 0
+		}
+		for i := range wav.Data {
+			wav.Data[i] = make([]float32, 0, capacity)
+		}
+	}
+
+	blockFrames := dataBlockSize / frameSize
+	if blockFrames == 0 {
+		blockFrames = 1
+	}
+	block := make([]byte, blockFrames*frameSize)
+	samples := make([][]float32, wav.NumChannels)
+	for i := range samples {
+		samples[i] = make([]float32, blockFrames)
+	}
+
+	for s < numSamples {
+		if left := numSamples - s; left < int64(blockFrames) {
+			block = block[:left*int64(frameSize)]
+		}
 
-			wav.Data[i] = append(wav.Data[i], sample)
+		n, err := io.ReadFull(cr, block)
+		frames := n / frameSize
+		for f, offset := 0, 0; f < frames; f++ {
+			for i := range samples {
+				samples[i][f] = decode(block[offset:])
+				offset += sampleSize
+			}
 		}
+		wav.appendSamples(trimSamples(samples, 0, 0, int64(frames)))
+		s += int64(frames)
 
-		i = 0
+		if streamed && (err == io.EOF || err == io.ErrUnexpectedEOF) && n%frameSize == 0 {
+			break
+		}
+		if streamed && err == io.ErrUnexpectedEOF {
+			wav.Subchunk2Size = s * int64(frameSize)
+			return errPartialFrame
+		}
+		if err != nil {
+			// the size of what was read, for Options.Lenient
+			wav.Subchunk2Size = s * int64(frameSize)
+			return fmt.Errorf("error reading sample: %w", truncated(err))
+		}
 	}
 
-	// all channels should have the same number of channels, but it's not always the case
-	// so make sure to trim the longer ones
-	minSamples := len(wav.Data[0])
-	for i := int16(0); i < wav.NumChannels; i++ {
-		l := len(wav.Data[0])
-		if l < minSamples {
-			minSamples = l
+	if streamed {
+		wav.Subchunk2Size = s * int64(frameSize)
+		if s == numSamples {
+			// the end of the span, after which the frames are only counted
+			n, err := cr.skipToEnd()
+			wav.Subchunk2Size += n / int64(frameSize) * int64(frameSize)
+			if err != nil {
+				return fmt.Errorf("error reading sample: %w", err)
+			}
+			if n%int64(frameSize) != 0 {
+				return errPartialFrame
+			}
 		}
+		return nil
 	}
 
-	for i := int16(0); i < wav.NumChannels; i++ {
-		wav.Data[i] = wav.Data[i][:minSamples]
+	// the frames after the span, and a partial frame at the end, are left out
+	if rest := wav.Subchunk2Size - s*int64(frameSize); rest > 0 {
+		if err := cr.skip(rest); err != nil {
+			return fmt.Errorf("error reading sample: %w", truncated(err))
+		}
 	}
 
 	return nil
 }
 
-func (w *Wav) GetMonoSamples() []int16 {
-	var monoSamples []int16
+// GetMonoSamples downmixes all the channels by averaging them.
+func (w *Wav) GetMonoSamples() []float32 {
 	length := len(w.Data[0])
+	monoSamples := make([]float32, 0, length)
 
 	var i int
 	for ; i < length; i++ {
-		var sum int32
+		var sum float32
 		var j int
 		numChannels := len(w.Data)
 		for ; j < numChannels; j++ {
-			sum += int32(w.Data[j][i])
+			sum += w.Data[j][i]
 		}
-		mean := int16(sum / int32(numChannels))
+		mean := sum / float32(numChannels)
 
 		monoSamples = append(monoSamples, mean)
 	}
@@ -226,23 +843,60 @@ func (w *Wav) GetMonoSamples() []int16 {
 	return monoSamples
 }
 
-func (w *Wav) GetFileSize() int32 {
+func (w *Wav) GetFileSize() int64 {
 	return w.ChunkSize + 8
 }
 
-func (w *Wav) GetNumSamples() int32 {
-	return w.Subchunk2Size / int32(w.NumChannels*w.BitsPerSample/8)
+func (w *Wav) GetNumSamples() int64 {
+	if w.isADPCM() {
+		if w.SampleLength > 0 {
+			return w.SampleLength
+		}
+
+		return w.getADPCMNumSamples()
+	}
+
+	if code := w.GetFormatCode(); code == FormatFLAC || code == FormatMPEGLayer3 {
+		return w.SampleLength
+	}
+
+	frameSize := int64(w.NumChannels) * int64(w.BitsPerSample) / 8
+	if frameSize <= 0 {
+		return 0
+	}
+
+	return w.Subchunk2Size / frameSize
 }
 
-func (w *Wav) GetDuration() (float64, int32) {
-	numSamples := float64(w.Subchunk2Size / int32(w.NumChannels*w.BitsPerSample/8))
+// GetDuration returns the duration in seconds, 0 if the sample rate is
+// missing, along with the number of samples.
+func (w *Wav) GetDuration() (float64, int64) {
+	numSamples := w.GetNumSamples()
+	if w.SampleRate <= 0 {
+		return 0, numSamples
+	}
 
-	return numSamples / float64(w.SampleRate), int32(numSamples)
+	return float64(numSamples) / float64(w.SampleRate), numSamples
 }
 
 func (w *Wav) GetFormattedDuration() string {
 	duration, samples := w.GetDuration()
 
+	return fmt.Sprintf("%s = %d samples", formatSeconds(duration), samples)
+}
+
+// GetFormattedSpan is like GetFormattedDuration, for the span that was decoded.
+func (w *Wav) GetFormattedSpan() string {
+	span := w.GetSpan()
+	start, end := 0.0, 0.0
+	if rate := float64(w.SampleRate); rate > 0 {
+		start, end = float64(span.Start)/rate, float64(span.End)/rate
+	}
+
+	return fmt.Sprintf("%s - %s = %d samples", formatSeconds(start), formatSeconds(end), span.Len())
+}
+
+func formatSeconds(duration float64) string {
 	d := int(duration)
 	milliseconds := int((duration - float64(d)) * 1000)
 
@@ -250,70 +904,94 @@ func (w *Wav) GetFormattedDuration() string {
 	minutes := d % 3600 / 60
 	seconds := d % 3600 % 60
 
-	return fmt.Sprintf("%02d:%02d:%02d.%03d = %d samples", hours, minutes, seconds, milliseconds, samples)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, seconds, milliseconds)
 }
 
-func (w *Wav) CheckFormat() error {
-	if w.AudioFormat != 1 && w.AudioFormat != 3 {
-		return fmt.Errorf("unsupported format: only PCM and IEEE float formats are supported")
+// GetFormatCode returns the format tag describing how the samples are encoded;
+// for WAVE_FORMAT_EXTENSIBLE files it's taken from the SubFormat GUID, and it's
+// 0 if the GUID isn't one derived from a format tag.
+func (w *Wav) GetFormatCode() uint16 {
+	if w.AudioFormat != FormatExtensible {
+		return w.AudioFormat
 	}
 
-	return nil
-}
-
-func scaleToInt16(v interface{}) int16 {
-	var input float64
-	var inputMin float64
-	var inputMax float64
-
-	switch t := v.(type) {
-	case uint8:
-		input = float64(t)
-		inputMin = float64(0)
-		inputMax = float64(math.MaxUint8)
-	case int16:
-		input = float64(t)
-		inputMin = float64(math.MinInt16)
-		inputMax = float64(math.MaxInt16)
-	case int32:
-		input = float64(t)
-		inputMin = float64(math.MinInt32)
-		inputMax = float64(math.MaxInt32)
-	case int64:
-		input = float64(t)
-		inputMin = float64(math.MinInt64)
-		inputMax = float64(math.MaxInt64)
-	case float32:
-		input = float64(t)
-		inputMin = float64(-1)
-		inputMax = float64(1)
-	case float64:
-		input = t
-		inputMin = float64(-1)
-		inputMax = float64(1)
-	default:
-		log.Fatal("unsupported type")
+	if !bytes.Equal(w.SubFormat[2:], subFormatSuffix[:]) {
+		return 0
 	}
 
-	return int16(scale(input, inputMin, inputMax, float64(math.MinInt16), float64(math.MaxInt16)))
+	return binary.LittleEndian.Uint16(w.SubFormat[:2])
 }
 
-func scale(input float64, inputMin float64, inputMax float64, outputMin float64, outputMax float64) float64 {
-	return (input-inputMin)*(outputMax-outputMin)/(inputMax-inputMin) + outputMin
+// IsExtensible reports whether the file uses the WAVE_FORMAT_EXTENSIBLE fmt chunk.
+func (w *Wav) IsExtensible() bool {
+	return w.AudioFormat == FormatExtensible
 }
 
-func read24BitSample(r io.Reader) (int32, error) {
-	var buf [3]byte
+// GetEncodingName returns a human readable name of the sample encoding.
+func (w *Wav) GetEncodingName() string {
+	switch w.GetFormatCode() {
+	case FormatPCM:
+		if !w.Signed {
+			return "Unsigned Integer PCM"
+		}
+		return "Signed Integer PCM"
+	case FormatIEEEFloat:
+		return "Floating Point PCM"
+	case FormatMSADPCM:
+		return "Microsoft ADPCM"
+	case FormatIMAADPCM:
+		return "IMA ADPCM"
+	case FormatALaw:
+		return "A-law"
+	case FormatMuLaw:
+		return "µ-law"
+	case FormatFLAC:
+		return "FLAC"
+	case FormatMPEGLayer3:
+		if w.MP3 != nil {
+			return w.MP3.Version + " Layer III"
+		}
+		return "MPEG Layer III"
+	default:
+		return fmt.Sprintf("Unknown (0x%04x)", w.GetFormatCode())
+	}
+}
 
-	err := binary.Read(r, binary.LittleEndian, &buf)
-	if err != nil {
-		return 0, err
+func (w *Wav) CheckFormat() error {
+	if w.SampleRate <= 0 || w.NumChannels <= 0 {
+		return fmt.Errorf("invalid format: %d channels at %d Hz", w.NumChannels, w.SampleRate)
 	}
 
-	sample := int32(buf[0]) | (int32(buf[1]) << 8) | (int32(buf[2]) << 16)
-	if (sample & (1 << 23)) != 0 {
-		sample |= ^((1 << 24) - 1)
+	switch w.GetFormatCode() {
+	case FormatPCM, FormatIEEEFloat, FormatFLAC:
+	case FormatMPEGLayer3:
+		if w.MP3 == nil {
+			return fmt.Errorf("unsupported format: MP3 is only supported in MP3 streams, not in WAVE files")
+		}
+	case FormatALaw, FormatMuLaw:
+		if w.BitsPerSample != 8 {
+			return fmt.Errorf("unsupported format: G.711 samples must be 8-bit, not %d-bit", w.BitsPerSample)
+		}
+	case FormatMSADPCM, FormatIMAADPCM:
+		if w.BitsPerSample != 4 {
+			return fmt.Errorf("unsupported format: ADPCM samples must be 4-bit, not %d-bit", w.BitsPerSample)
+		}
+	default:
+		return fmt.Errorf("unsupported format: only PCM, IEEE float, A-law, µ-law, ADPCM, FLAC and MP3 formats are supported")
+	}
+
+	return nil
+}
+
+// int24 reads a signed 24-bit integer from the start of b.
+func int24(b []byte, byteOrder binary.ByteOrder) int32 {
+	var sample int32
+	if byteOrder == binary.BigEndian {
+		sample = int32(b[0])<<16 | int32(b[1])<<8 | int32(b[2])
+	} else {
+		sample = int32(b[2])<<16 | int32(b[1])<<8 | int32(b[0])
 	}
 
-	return sample, nil
+	// sign-extend it
+	return sample << 8 >> 8
 }
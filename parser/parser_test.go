@@ -2,6 +2,13 @@ package parser
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -20,14 +27,776 @@ func TestReading24BitSamples(t *testing.T) {
 		0b11111111, 0b11111111, 0b11111111, // -1
 	}
 
-	r := bytes.NewReader(data)
-
 	expected := []int32{127, -127, 0, 32768, -32768, 128, 4194304, -4194304 - 1, -4194304, -1}
 
 	for i, _ := range expected {
-		sample, _ := read24BitSample(r)
+		sample := int24(data[3*i:], binary.LittleEndian)
 		if expected[i] != sample {
 			t.Errorf("expected %d does not equal given %d", expected[i], sample)
 		}
+
+		// the same bytes, in big-endian order
+		reversed := []byte{data[3*i+2], data[3*i+1], data[3*i]}
+		if sample := int24(reversed, binary.BigEndian); expected[i] != sample {
+			t.Errorf("expected %d does not equal given %d in big-endian order", expected[i], sample)
+		}
+	}
+}
+
+func TestNormalizingSamples(t *testing.T) {
+	tests := []struct {
+		data       []byte
+		sampleSize int
+		formatCode uint16
+		expected   float32
+	}{
+		{[]byte{0x00}, 8, FormatPCM, -1},
+		{[]byte{0x80}, 8, FormatPCM, 0},
+		{[]byte{0x00, 0x80}, 16, FormatPCM, -1},
+		{[]byte{0x00, 0x40}, 16, FormatPCM, 0.5},
+		{[]byte{0x00, 0x00, 0x80}, 24, FormatPCM, -1},
+		{[]byte{0x01, 0x00, 0x00}, 24, FormatPCM, 1.0 / (1 << 23)},
+		{[]byte{0x00, 0x00, 0x00, 0xc0}, 32, FormatPCM, -0.5},
+		{[]byte{0x00, 0x00, 0x80, 0x3e}, 32, FormatIEEEFloat, 0.25},
+		{[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xe0, 0xbf}, 64, FormatIEEEFloat, -0.5},
+	}
+
+	for _, test := range tests {
+		decode, err := sampleDecoder(sampleFormat{size: test.sampleSize, code: test.formatCode, byteOrder: binary.LittleEndian, signed: test.sampleSize > 8})
+		if err != nil {
+			t.Fatalf("failed reading a %d-bit sample: %v", test.sampleSize, err)
+		}
+		if sample := decode(test.data); sample != test.expected {
+			t.Errorf("expected %g does not equal given %g for a %d-bit sample", test.expected, sample, test.sampleSize)
+		}
+	}
+}
+
+func TestParsingSeekableAndPlainReaders(t *testing.T) {
+	data, err := os.ReadFile("../test-files/2ch-48000-16bit-signed.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seekable, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing the seekable reader: %v", err)
+	}
+
+	plain, err := Parse(io.MultiReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("failed parsing the plain reader: %v", err)
+	}
+
+	if seekable.GetNumSamples() != plain.GetNumSamples() {
+		t.Errorf("expected %d samples, given %d", seekable.GetNumSamples(), plain.GetNumSamples())
+	}
+
+	for c := range seekable.Data {
+		for i := range seekable.Data[c] {
+			if seekable.Data[c][i] != plain.Data[c][i] {
+				t.Fatalf("sample %d on channel %d differs: %f != %f", i, c, seekable.Data[c][i], plain.Data[c][i])
+			}
+		}
+	}
+
+	if _, err := Parse(bytes.NewReader([]byte("fLaC\x00\x00\x00\x22"))); err == nil {
+		t.Errorf("expected an error for a non-RIFF input")
+	}
+
+	// a trailing chunk cut short, which seeking over mustn't hide
+	cut := makeRiff(
+		makeChunk("fmt ", FormatPCM, int16(1), int32(8000), int32(16000), int16(2), int16(16)),
+		makeChunk("data", []int16{0, 1}),
+		makeChunk("junk", make([]byte, 1000)),
+	)
+	cut = cut[:len(cut)-900]
+	for _, r := range []io.Reader{bytes.NewReader(cut), io.MultiReader(bytes.NewReader(cut))} {
+		if _, err := Parse(r); !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected a truncated junk chunk from a %T, given %v", r, err)
+		}
+	}
+
+	// a reader left past the end has nothing left rather than less
+	past := bytes.NewReader(cut)
+	_, _ = past.Seek(int64(len(cut))+100, io.SeekStart)
+	if left, ok := newChunkReader(past).remaining(); !ok || left != 0 {
+		t.Errorf("expected nothing left past the end, given %d", left)
+	}
+}
+
+// makeStreamedADPCM makes an ADPCM file as if it had been written to a pipe,
+// with size bytes of silent blocks and the data size left unknown.
+func makeStreamedADPCM(format uint16, channels, blockAlign int16, size int) []byte {
+	samplesPerBlock := int16((&Wav{AudioFormat: format, NumChannels: channels}).getADPCMSamplesInBlock(int64(blockAlign)))
+	data := makeRiff(makeChunk("fmt ", format, channels, int32(8000), int32(4000), blockAlign, int16(4), int16(2), samplesPerBlock))
+	data = append(data, "data\xff\xff\xff\xff"...)
+
+	// IMA blocks start each channel at step index 0, MS ADPCM ones with
+	// the first predictor and a delta of 16
+	block := make([]byte, blockAlign)
+	if format == FormatMSADPCM {
+		for ch := 0; ch < int(channels); ch++ {
+			block[int(channels)+2*ch] = 16
+		}
+	}
+	stream := make([]byte, 0, size)
+	for len(stream) < size {
+		stream = append(stream, block...)
+	}
+
+	return append(data, stream[:size]...)
+}
+
+func TestParsingHeaders(t *testing.T) {
+	files, err := filepath.Glob("../test-files/*.wav")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test files: %v", err)
+	}
+
+	inputs := map[string][]byte{
+		// streamed ADPCM, with the last block cut short
+		"streamed mono IMA ADPCM":   makeStreamedADPCM(FormatIMAADPCM, 1, 256, 640),
+		"streamed stereo IMA ADPCM": makeStreamedADPCM(FormatIMAADPCM, 2, 512, 1300),
+		"streamed stereo MS ADPCM":  makeStreamedADPCM(FormatMSADPCM, 2, 512, 1301),
+		"streamed quad IMA ADPCM":   makeStreamedADPCM(FormatIMAADPCM, 4, 1024, 2051),
+	}
+	for _, file := range files {
+		if inputs[file], err = os.ReadFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, data := range inputs {
+		wav, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed parsing %s: %v", name, err)
+		}
+		if wav.GetNumSamples() != int64(len(wav.Data[0])) {
+			t.Errorf("%s: expected %d samples, given %d decoded", name, wav.GetNumSamples(), len(wav.Data[0]))
+		}
+
+		for _, r := range []io.Reader{bytes.NewReader(data), io.MultiReader(bytes.NewReader(data))} {
+			header, err := ParseHeader(r)
+			if err != nil {
+				t.Fatalf("failed parsing the header of %s: %v", name, err)
+			}
+
+			if header.Data != nil {
+				t.Errorf("%s: expected no samples to be decoded", name)
+			}
+			if header.GetNumSamples() != wav.GetNumSamples() || header.GetFileSize() != wav.GetFileSize() || header.GetEncodingName() != wav.GetEncodingName() {
+				t.Errorf("%s: expected %d samples, %d bytes, %s, given %d, %d, %s", name,
+					wav.GetNumSamples(), wav.GetFileSize(), wav.GetEncodingName(),
+					header.GetNumSamples(), header.GetFileSize(), header.GetEncodingName())
+			}
+		}
+	}
+}
+
+func makeChunk(id string, fields ...interface{}) []byte {
+	return makeChunkInOrder(binary.LittleEndian, id, fields...)
+}
+
+func makeChunkInOrder(byteOrder binary.ByteOrder, id string, fields ...interface{}) []byte {
+	var payload bytes.Buffer
+	for _, f := range fields {
+		_ = binary.Write(&payload, byteOrder, f)
+	}
+
+	var chunk bytes.Buffer
+	chunk.WriteString(id)
+	_ = binary.Write(&chunk, byteOrder, uint32(payload.Len()))
+	chunk.Write(payload.Bytes())
+	if payload.Len()%2 == 1 {
+		chunk.WriteByte(0)
+	}
+
+	return chunk.Bytes()
+}
+
+func makeRiff(chunks ...[]byte) []byte {
+	return makeRiffInOrder(binary.LittleEndian, chunks...)
+}
+
+// makeRiffInOrder makes a RIFF file, or a RIFX file when byteOrder is
+// big-endian.
+func makeRiffInOrder(byteOrder binary.ByteOrder, chunks ...[]byte) []byte {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	for _, c := range chunks {
+		body.Write(c)
+	}
+
+	var riff bytes.Buffer
+	if byteOrder == binary.BigEndian {
+		riff.WriteString("RIFX")
+	} else {
+		riff.WriteString("RIFF")
+	}
+	_ = binary.Write(&riff, byteOrder, uint32(body.Len()))
+	riff.Write(body.Bytes())
+
+	return riff.Bytes()
+}
+
+func TestParsingExtensibleFormat(t *testing.T) {
+	pcmGUID := [16]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+	data := makeRiff(
+		makeChunk("fmt ",
+			FormatExtensible, int16(2), int32(48000), int32(192000), int16(4), int16(16),
+			int16(22), int16(12), uint32(0x3), pcmGUID,
+		),
+		makeChunk("data", []int16{math.MinInt16, math.MaxInt16, 0, 0}),
+	)
+
+	wav, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	if err := wav.CheckFormat(); err != nil {
+		t.Fatalf("validation failed: %v", err)
+	}
+
+	if !wav.IsExtensible() || wav.GetFormatCode() != FormatPCM {
+		t.Errorf("expected an extensible PCM file, given format 0x%x / 0x%x", wav.AudioFormat, wav.GetFormatCode())
+	}
+	if wav.ValidBitsPerSample != 12 || wav.ChannelMask != 0x3 {
+		t.Errorf("expected 12 valid bits and mask 0x3, given %d and 0x%x", wav.ValidBitsPerSample, wav.ChannelMask)
+	}
+
+	expected := [][]float32{{-1, 0}, {float32(math.MaxInt16) / 32768, 0}}
+	for c := range expected {
+		for i := range expected[c] {
+			if wav.Data[c][i] != expected[c][i] {
+				t.Errorf("expected %f does not equal given %f", expected[c][i], wav.Data[c][i])
+			}
+		}
+	}
+}
+
+func TestCheckingMissingSampleRate(t *testing.T) {
+	data := makeRiff(
+		makeChunk("fmt ", FormatPCM, int16(1), int32(0), int32(0), int16(2), int16(16)),
+		makeChunk("data", []int16{0, 1}),
+	)
+
+	wav, err := ParseHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	if err := wav.CheckFormat(); err == nil {
+		t.Error("expected a validation error for a sample rate of 0")
+	}
+	if duration, _ := wav.GetDuration(); duration != 0 {
+		t.Errorf("expected no duration, given %f", duration)
+	}
+}
+
+func TestParsingRifx(t *testing.T) {
+	pcmGUID := [16]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+	bigEndianGUID := [16]byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x10, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+	var files [2]*Wav
+	for i, byteOrder := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		guid := pcmGUID
+		samples := []byte{0x00, 0x00, 0xc0, 0xff, 0xff, 0x7f, 0x01, 0x00, 0x00, 0x00, 0x00, 0x80}
+		if byteOrder == binary.BigEndian {
+			guid = bigEndianGUID
+			samples = []byte{0xc0, 0x00, 0x00, 0x7f, 0xff, 0xff, 0x00, 0x00, 0x01, 0x80, 0x00, 0x00}
+		}
+
+		data := makeRiffInOrder(byteOrder,
+			makeChunkInOrder(byteOrder, "fmt ",
+				FormatExtensible, int16(2), int32(48000), int32(288000), int16(6), int16(24),
+				int16(22), int16(24), uint32(0x3), guid,
+			),
+			makeChunkInOrder(byteOrder, "LIST", []byte("INFO"), makeChunkInOrder(byteOrder, "INAM", []byte("Take\x00"))),
+			makeChunkInOrder(byteOrder, "cue ", uint32(1), uint32(1), uint32(1), [4]byte{'d', 'a', 't', 'a'}, uint32(0), uint32(0), uint32(1)),
+			makeChunkInOrder(byteOrder, "data", samples),
+		)
+
+		wav, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed parsing: %v", err)
+		}
+		if err := wav.CheckFormat(); err != nil {
+			t.Fatalf("validation failed: %v", err)
+		}
+		files[i] = wav
+	}
+
+	riff, rifx := files[0], files[1]
+	if rifx.GetFormatCode() != FormatPCM || rifx.SampleRate != 48000 || rifx.BitsPerSample != 24 || rifx.ChannelMask != 0x3 {
+		t.Errorf("unexpected format: 0x%x, %d Hz, %d-bit, mask 0x%x", rifx.GetFormatCode(), rifx.SampleRate, rifx.BitsPerSample, rifx.ChannelMask)
+	}
+	if rifx.SubFormat != riff.SubFormat {
+		t.Errorf("expected the sub format %x, given %x", riff.SubFormat, rifx.SubFormat)
+	}
+
+	expected := [][]float32{{-0.5, 1.0 / (1 << 23)}, {float32(1<<23-1) / (1 << 23), -1}}
+	for _, wav := range files {
+		for c := range expected {
+			for i := range expected[c] {
+				if wav.Data[c][i] != expected[c][i] {
+					t.Errorf("%s: expected %f does not equal given %f", wav.ChunkID, expected[c][i], wav.Data[c][i])
+				}
+			}
+		}
+
+		if wav.Metadata["title"] != "Take" || len(wav.Markers) != 1 || wav.Markers[0].Offset != 1 {
+			t.Errorf("%s: unexpected metadata %v and markers %+v", wav.ChunkID, wav.Metadata, wav.Markers)
+		}
+	}
+}
+
+func TestParsingRF64(t *testing.T) {
+	samples := []int16{1, -1, 2, -2, 3, -3}
+
+	var data bytes.Buffer
+	data.WriteString("RF64")
+	_ = binary.Write(&data, binary.LittleEndian, uint32(0xFFFFFFFF))
+	data.WriteString("WAVE")
+	data.Write(makeChunk("ds64", uint64(4+36+24+8+12), uint64(12), uint64(3), uint32(0)))
+	data.Write(makeChunk("fmt ", FormatPCM, int16(2), int32(8000), int32(32000), int16(4), int16(16)))
+	data.WriteString("data")
+	_ = binary.Write(&data, binary.LittleEndian, uint32(0xFFFFFFFF))
+	_ = binary.Write(&data, binary.LittleEndian, samples)
+
+	wav, err := Parse(bytes.NewReader(data.Bytes()))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+
+	if wav.Subchunk2Size != 12 {
+		t.Errorf("expected a data size of 12, given %d", wav.Subchunk2Size)
+	}
+	if wav.GetNumSamples() != 3 || len(wav.Data[0]) != 3 {
+		t.Errorf("expected 3 samples, given %d (%d decoded)", wav.GetNumSamples(), len(wav.Data[0]))
+	}
+	if wav.GetFileSize() != int64(data.Len()) {
+		t.Errorf("expected a file size of %d, given %d", data.Len(), wav.GetFileSize())
+	}
+}
+
+func TestDecodingG711(t *testing.T) {
+	alaw := map[uint8]int16{0xd5: 8, 0x55: -8, 0xaa: 32256, 0x2a: -32256, 0x80: 5504}
+	for in, expected := range alaw {
+		if given := alawToLinear(in); given != expected {
+			t.Errorf("A-law 0x%02x: expected %d does not equal given %d", in, expected, given)
+		}
+	}
+
+	mulaw := map[uint8]int16{0xff: 0, 0x7f: 0, 0x80: 32124, 0x00: -32124, 0xf0: 120}
+	for in, expected := range mulaw {
+		if given := mulawToLinear(in); given != expected {
+			t.Errorf("µ-law 0x%02x: expected %d does not equal given %d", in, expected, given)
+		}
+	}
+}
+
+func TestParsingInfoMetadata(t *testing.T) {
+	data := makeRiff(
+		makeChunk("fmt ", FormatPCM, int16(1), int32(8000), int32(16000), int16(2), int16(16)),
+		makeChunk("LIST", []byte("INFO"),
+			makeChunk("INAM", []byte("A title\x00")),
+			makeChunk("IART", []byte("Artist\x00")),
+			makeChunk("IXYZ", []byte("odd\x00\x00")),
+		),
+		makeChunk("data", []int16{0, 1, 2, 3}),
+	)
+
+	wav, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+
+	expected := map[string]string{"title": "A title", "artist": "Artist", "IXYZ": "odd"}
+	for k, v := range expected {
+		if wav.Metadata[k] != v {
+			t.Errorf("expected %s=%q, given %q", k, v, wav.Metadata[k])
+		}
+	}
+	if len(wav.Data[0]) != 4 {
+		t.Errorf("expected 4 samples, given %d", len(wav.Data[0]))
+	}
+}
+
+func TestParsingBext(t *testing.T) {
+	pad := func(s string, n int) []byte {
+		b := make([]byte, n)
+		copy(b, s)
+		return b
+	}
+
+	data := makeRiff(
+		makeChunk("fmt ", FormatPCM, int16(1), int32(48000), int32(96000), int16(2), int16(16)),
+		makeChunk("bext",
+			pad("Scene 4", 256), pad("Recorder", 32), pad("REF1", 32),
+			[]byte("2024-05-01"), []byte("10:15:30"),
+			uint64(36930*48000), uint16(2), [64]byte{},
+			[]int16{-2300, 520, -100, -1800, -2000}, [180]byte{},
+			[]byte("A=PCM\r\n\x00"),
+		),
+		makeChunk("data", []int16{0, 1}),
+	)
+
+	wav, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+
+	bext := wav.Bext
+	if bext == nil {
+		t.Fatal("expected a bext chunk")
+	}
+	if bext.Description != "Scene 4" || bext.Originator != "Recorder" || bext.OriginatorReference != "REF1" {
+		t.Errorf("unexpected text fields: %q, %q, %q", bext.Description, bext.Originator, bext.OriginatorReference)
+	}
+	if bext.OriginationDate != "2024-05-01" || bext.OriginationTime != "10:15:30" {
+		t.Errorf("unexpected origination: %s %s", bext.OriginationDate, bext.OriginationTime)
+	}
+	if bext.TimeReference != 36930*48000 {
+		t.Errorf("expected time reference %d, given %d", 36930*48000, bext.TimeReference)
+	}
+	if !bext.HasLoudness() || bext.LoudnessValue != -23 || bext.MaxTruePeakLevel != -1 {
+		t.Errorf("unexpected loudness: %.2f LUFS, %.2f dBTP", bext.LoudnessValue, bext.MaxTruePeakLevel)
+	}
+	if bext.CodingHistory != "A=PCM" {
+		t.Errorf("unexpected coding history %q", bext.CodingHistory)
+	}
+}
+
+func TestParsingPeakChunk(t *testing.T) {
+	floatFmt := makeChunk("fmt ", FormatIEEEFloat, int16(2), int32(48000), int32(384000), int16(8), int16(32))
+	samples := makeChunk("data", []float32{0.25, -0.75, -0.5, 0.5})
+
+	tests := []struct {
+		name     string
+		data     []byte
+		measured bool
+		matches  bool
+	}{
+		{"before the data", makeRiff(floatFmt, makeChunk("PEAK", uint32(1), uint32(1700000000), float32(0.5), uint32(1), float32(0.75), uint32(0)), samples), true, true},
+		{"wrong", makeRiff(floatFmt, makeChunk("PEAK", uint32(1), uint32(1700000000), float32(0.5), uint32(1), float32(0.9), uint32(0)), samples), true, false},
+		{"after the data", makeRiff(floatFmt, samples, makeChunk("PEAK", uint32(1), uint32(1700000000), float32(0.5), uint32(1), float32(0.75), uint32(0))), false, false},
+	}
+
+	for _, test := range tests {
+		wav, err := Parse(bytes.NewReader(test.data))
+		if err != nil {
+			t.Fatalf("%s: failed parsing: %v", test.name, err)
+		}
+
+		peak := wav.PeakChunk
+		if peak == nil || peak.Version != 1 || peak.Timestamp != 1700000000 || len(peak.Peaks) != 2 {
+			t.Fatalf("%s: unexpected PEAK chunk %+v", test.name, peak)
+		}
+		if peak.Peaks[0] != (PositionPeak{0.5, 1}) || peak.Peaks[1].Value < 0.75 {
+			t.Errorf("%s: unexpected peaks %v", test.name, peak.Peaks)
+		}
+
+		if !test.measured {
+			if peak.Measured != nil {
+				t.Errorf("%s: expected the peaks not to be measured", test.name)
+			}
+			continue
+		}
+		expected := []PositionPeak{{0.5, 1}, {0.75, 0}}
+		if len(peak.Measured) != 2 || peak.Measured[0] != expected[0] || peak.Measured[1] != expected[1] {
+			t.Errorf("%s: expected the measured peaks %v, given %v", test.name, expected, peak.Measured)
+		}
+		if matches := peak.Peaks[0].Matches(peak.Measured[0]) && peak.Peaks[1].Matches(peak.Measured[1]); matches != test.matches {
+			t.Errorf("%s: expected the check to be %v", test.name, test.matches)
+		}
+	}
+}
+
+func TestParsingID3Chunk(t *testing.T) {
+	frames := bytes.Join([][]byte{
+		id3Frame("TIT2", []byte("\x03Episode 12")),
+		id3Frame("COMM", []byte("\x00engShow notes\x00Guest: Ann")),
+		id3Frame("APIC", []byte("\x00image/png\x00\x04\x00back")),
+		id3Frame("APIC", []byte("\x01jpg\x00\x03\xff\xfeC\x00\x00\x00\xff\xd8\xff")),
+	}, nil)
+
+	var tag bytes.Buffer
+	tag.WriteString("ID3\x03\x00\x00")
+	tag.Write([]byte{0, 0, byte(len(frames) >> 7), byte(len(frames) & 0x7F)})
+	tag.Write(frames)
+
+	for _, id := range []string{"id3 ", "ID3 "} {
+		data := makeRiff(
+			makeChunk("fmt ", FormatPCM, int16(1), int32(48000), int32(96000), int16(2), int16(16)),
+			makeChunk("data", []int16{0, 1}),
+			makeChunk(id, tag.Bytes()),
+		)
+
+		wav, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%q: failed parsing: %v", id, err)
+		}
+
+		if wav.Metadata["title"] != "Episode 12" || wav.Metadata["comment"] != "Guest: Ann" {
+			t.Errorf("%q: unexpected metadata: %v", id, wav.Metadata)
+		}
+
+		if len(wav.Pictures) != 2 {
+			t.Fatalf("%q: expected 2 pictures, given %d", id, len(wav.Pictures))
+		}
+		cover := wav.GetCoverArt()
+		if cover == nil || cover.GetTypeName() != "front cover" || cover.MIMEType != "image/jpeg" || cover.Description != "C" || !bytes.Equal(cover.Data, []byte{0xff, 0xd8, 0xff}) {
+			t.Errorf("%q: unexpected cover art %+v", id, cover)
+		}
+		if back := wav.Pictures[0]; back.MIMEType != "image/png" || string(back.Data) != "back" {
+			t.Errorf("%q: unexpected picture %+v", id, back)
+		}
+	}
+}
+
+func TestParsingIXML(t *testing.T) {
+	ixml := `<?xml version="1.0" encoding="UTF-8"?>
+<BWFXML>
+	<IXML_VERSION>2.10</IXML_VERSION>
+	<PROJECT>Night Shoot</PROJECT>
+	<SCENE>12A</SCENE>
+	<TAKE>3</TAKE>
+	<CIRCLED>TRUE</CIRCLED>
+	<SPEED>
+		<TIMECODE_RATE>30000/1001</TIMECODE_RATE>
+		<TIMECODE_FLAG>NDF</TIMECODE_FLAG>
+		<TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>1</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>
+		<TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO>4</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO>
+	</SPEED>
+	<TRACK_LIST>
+		<TRACK_COUNT>2</TRACK_COUNT>
+		<TRACK><CHANNEL_INDEX>3</CHANNEL_INDEX><INTERLEAVE_INDEX>2</INTERLEAVE_INDEX><NAME>Lav</NAME></TRACK>
+		<TRACK><CHANNEL_INDEX>1</CHANNEL_INDEX><INTERLEAVE_INDEX>1</INTERLEAVE_INDEX><NAME>Boom</NAME><FUNCTION>M-MID_SIDE</FUNCTION></TRACK>
+	</TRACK_LIST>
+</BWFXML>` + "\x00\x00"
+
+	data := makeRiff(
+		makeChunk("fmt ", FormatPCM, int16(2), int32(48000), int32(192000), int16(4), int16(16)),
+		makeChunk("iXML", []byte(ixml)),
+		makeChunk("axml", []byte(`<ebuCoreMain xmlns="urn:ebu:metadata-schema:ebuCore_2014"><coreMetadata/></ebuCoreMain>`)),
+		makeChunk("data", []int16{0, 1}),
+	)
+
+	wav, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+
+	x := wav.IXML
+	if x == nil {
+		t.Fatal("expected an iXML chunk")
+	}
+	if x.Project != "Night Shoot" || x.Scene != "12A" || x.Take != "3" || !x.Circled {
+		t.Errorf("unexpected production fields: %+v", *x)
+	}
+	if x.GetFPS() != 30 || x.TimecodeFlag != "NDF" || x.TimestampSamples != 1<<32|4 {
+		t.Errorf("unexpected timecode: %s %s, %d samples", x.TimecodeRate, x.TimecodeFlag, x.TimestampSamples)
+	}
+	if wav.GetChannelName(0) != "Boom" || wav.GetChannelName(1) != "Lav" || wav.GetChannelName(2) != "" {
+		t.Errorf("unexpected track names: %+v", x.Tracks)
+	}
+	if wav.GetAXMLRoot() != "ebuCoreMain" {
+		t.Errorf("unexpected axml document %q", wav.AXML)
+	}
+}
+
+func TestIXMLStartTimecode(t *testing.T) {
+	tests := []struct {
+		rate, flag string
+		samples    uint64
+		expected   string
+	}{
+		{"25/1", "NDF", 3600 * 48000, "01:00:00:00"},
+		// 10 minutes of wall clock time are 17982 frames at 29.97 fps...
+		{"30000/1001", "NDF", 600 * 48000, "00:09:59:12"},
+		// ...which drop frame timecode keeps up with
+		{"30000/1001", "DF", 600 * 48000, "00:10:00;00"},
+		{"30000/1001", "DF", 60 * 48000, "00:00:59;28"},
+		{"30000/1001", "DF", 2882880, "00:01:00;02"},
+		{"24000/1001", "NDF", 3600*48000 + 24000, "00:59:56:21"},
+		{"", "", 48000, ""},
+	}
+
+	for _, test := range tests {
+		x := &IXML{TimecodeRate: test.rate, TimecodeFlag: test.flag, TimestampSamples: test.samples}
+		if given := x.GetStartTimecode(48000); given != test.expected {
+			t.Errorf("%s %s at sample %d: expected %q, given %q", test.rate, test.flag, test.samples, test.expected, given)
+		}
+	}
+}
+
+func TestParsingChannelLayout(t *testing.T) {
+	pcmGUID := [16]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+	ixml := `<BWFXML><TRACK_LIST><TRACK><INTERLEAVE_INDEX>4</INTERLEAVE_INDEX><NAME>Boom</NAME></TRACK></TRACK_LIST></BWFXML>`
+
+	// a mask of FL, FR and LFE, which leaves the last channel without a position
+	data := makeRiff(
+		makeChunk("fmt ",
+			FormatExtensible, int16(4), int32(48000), int32(384000), int16(8), int16(16),
+			int16(22), int16(16), uint32(0xB), pcmGUID,
+		),
+		makeChunk("iXML", []byte(ixml)),
+		makeChunk("data", []int16{100, 200, -16384, 300, 0, 0, 8192, 0}),
+	)
+
+	wav, err := ParseWithOptions(bytes.NewReader(data), Options{Buckets: 2, Channel: "lfe"})
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+
+	if layout := strings.Join(wav.GetChannelLayout(), ","); layout != "FL,FR,LFE," {
+		t.Errorf("unexpected layout %q", layout)
+	}
+	if wav.GetChannelLabel(0) != "FL" || wav.GetChannelLabel(3) != "Boom" {
+		t.Errorf("unexpected labels %q and %q", wav.GetChannelLabel(0), wav.GetChannelLabel(3))
+	}
+	if wav.SelectedChannel != 3 || wav.Peaks.Min[0] != -0.5 || wav.Peaks.Max[1] != 0.25 {
+		t.Errorf("expected the peaks of channel 3, given channel %d with %v and %v", wav.SelectedChannel, wav.Peaks.Min, wav.Peaks.Max)
+	}
+
+	for name, expected := range map[string]int{"1": 0, "FR": 1, "boom": 3} {
+		if ch, ok := wav.FindChannel(name); !ok || ch != expected {
+			t.Errorf("expected %q to be channel %d, given %d", name, expected, ch)
+		}
+	}
+	for _, name := range []string{"0", "5", "FC", ""} {
+		if ch, ok := wav.FindChannel(name); ok {
+			t.Errorf("expected no channel %q, given %d", name, ch)
+		}
+	}
+
+	// a bad option, which isn't salvaged like a damaged chunk would be
+	for _, lenient := range []bool{false, true} {
+		_, err := ParseWithOptions(bytes.NewReader(data), Options{Channel: "BC", Lenient: lenient})
+		if _, ok := err.(*ChannelError); !ok {
+			t.Errorf("expected a channel error selecting a missing channel, given %v", err)
+		}
+	}
+
+	// without a mask, 6 channels are taken to be 5.1
+	wav = &Wav{NumChannels: 6}
+	if layout := strings.Join(wav.GetChannelLayout(), ","); layout != "FL,FR,FC,LFE,BL,BR" {
+		t.Errorf("unexpected default layout %q", layout)
+	}
+
+	// which AIFF orders differently, and leaves undefined for 4 channels
+	wav = &Wav{ChunkID: [4]byte{'F', 'O', 'R', 'M'}, NumChannels: 6}
+	if layout := strings.Join(wav.GetChannelLayout(), ","); layout != "FL,FLC,FC,FR,FRC,BC" {
+		t.Errorf("unexpected AIFF layout %q", layout)
+	}
+	wav.NumChannels = 4
+	if layout := strings.Join(wav.GetChannelLayout(), ","); layout != ",,," {
+		t.Errorf("unexpected AIFF layout %q", layout)
+	}
+}
+
+func TestParsingCueMarkers(t *testing.T) {
+	cuePoint := func(id, offset uint32) []interface{} {
+		return []interface{}{id, offset, [4]byte{'d', 'a', 't', 'a'}, uint32(0), uint32(0), offset}
+	}
+
+	var cue []interface{}
+	cue = append(cue, uint32(2))
+	cue = append(cue, cuePoint(7, 300)...)
+	cue = append(cue, cuePoint(3, 100)...)
+
+	data := makeRiff(
+		makeChunk("fmt ", FormatPCM, int16(1), int32(8000), int32(16000), int16(2), int16(16)),
+		makeChunk("LIST", []byte("adtl"),
+			makeChunk("labl", uint32(3), []byte("Start\x00")),
+			makeChunk("ltxt", uint32(7), uint32(50), []byte("rgn "), [4]uint16{}),
+			makeChunk("note", uint32(7), []byte("Chorus\x00")),
+		),
+		makeChunk("cue ", cue...),
+		makeChunk("data", make([]int16, 400)),
+	)
+
+	wav, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+
+	expected := []Marker{
+		{ID: 3, Offset: 100, Label: "Start"},
+		{ID: 7, Offset: 300, Length: 50, Note: "Chorus"},
+	}
+	if len(wav.Markers) != len(expected) {
+		t.Fatalf("expected %d markers, given %d", len(expected), len(wav.Markers))
+	}
+	for i := range expected {
+		if wav.Markers[i] != expected[i] {
+			t.Errorf("expected marker %+v does not equal given %+v", expected[i], wav.Markers[i])
+		}
+	}
+	if wav.Markers[0].IsRegion() || !wav.Markers[1].IsRegion() {
+		t.Errorf("expected only the second marker to be a region")
+	}
+}
+
+func TestParsingSamplerChunks(t *testing.T) {
+	data := makeRiff(
+		makeChunk("fmt ", FormatPCM, int16(1), int32(8000), int32(16000), int16(2), int16(16)),
+		makeChunk("smpl",
+			[9]uint32{0, 0, 125000, 69, 0, 0, 0, 1, 0},
+			[6]uint32{0, LoopPingPong, 10, 20, 0, 3},
+		),
+		// 7 bytes long, so followed by a pad byte
+		makeChunk("inst", []byte{60, 0xfd, 0, 48, 72, 1, 127}),
+		makeChunk("data", make([]int16, 30)),
+	)
+
+	wav, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+
+	if wav.Sampler == nil || len(wav.Sampler.Loops) != 1 {
+		t.Fatal("expected a smpl chunk with one loop")
+	}
+	expectedLoop := SampleLoop{Type: LoopPingPong, Start: 10, End: 20, PlayCount: 3}
+	if wav.Sampler.Loops[0] != expectedLoop {
+		t.Errorf("expected loop %+v does not equal given %+v", expectedLoop, wav.Sampler.Loops[0])
+	}
+	if GetNoteName(wav.Sampler.MIDIUnityNote) != "A4" {
+		t.Errorf("expected the A4 unity note, given %s", GetNoteName(wav.Sampler.MIDIUnityNote))
+	}
+
+	expectedInst := Instrument{UnshiftedNote: 60, FineTune: -3, LowNote: 48, HighNote: 72, LowVelocity: 1, HighVelocity: 127}
+	if wav.Instrument == nil || *wav.Instrument != expectedInst {
+		t.Errorf("expected instrument %+v does not equal given %+v", expectedInst, wav.Instrument)
+	}
+	if len(wav.Data[0]) != 30 {
+		t.Errorf("expected 30 samples after the padded inst chunk, given %d", len(wav.Data[0]))
+	}
+}
+
+func BenchmarkParsing(b *testing.B) {
+	files, err := filepath.Glob("../test-files/*.wav")
+	if err != nil || len(files) == 0 {
+		b.Fatalf("no test files: %v", err)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(filepath.Base(file), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := Parse(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
 	}
 }
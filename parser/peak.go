@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// PeakChunk holds the PEAK chunk that many audio editors add to floating
+// point files (and the peak chunk of CAF files), which stores the peak of
+// each channel so that it doesn't have to be looked for in the samples.
+type PeakChunk struct {
+	Version   uint32 // 1; the edit count in CAF files
+	Timestamp uint32 // when the peaks were computed, in seconds since 1970
+	Peaks     []PositionPeak
+
+	// the peaks found while decoding the samples, to check the stored ones
+	// against; nil unless all of the samples were decoded
+	Measured []PositionPeak
+}
+
+// PositionPeak is the peak of a channel: its largest absolute sample value,
+// normalized, and where it is, in samples per channel.
+type PositionPeak struct {
+	Value    float32
+	Position int64
+}
+
+// Matches reports whether two peaks have the same value, up to the precision
+// the editors that write them usually have; a value can peak more than once,
+// so the positions can differ.
+func (p PositionPeak) Matches(q PositionPeak) bool {
+	return math.Abs(float64(p.Value-q.Value)) <= 1e-4
+}
+
+// parsePeak reads the PEAK chunk of WAVE and AIFF files, whose peaks are a
+// float value followed by a 32-bit position.
+func parsePeak(r io.Reader, wav *Wav, chunkSize int64, byteOrder binary.ByteOrder) error {
+	if chunkSize < 8 {
+		return fmt.Errorf("%w: PEAK chunk of %d bytes", ErrChunkSize, chunkSize)
+	}
+
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	peak := &PeakChunk{
+		Version:   byteOrder.Uint32(chunk),
+		Timestamp: byteOrder.Uint32(chunk[4:]),
+	}
+	for b := chunk[8:]; len(b) >= 8; b = b[8:] {
+		peak.Peaks = append(peak.Peaks, PositionPeak{
+			Value:    math.Float32frombits(byteOrder.Uint32(b)),
+			Position: int64(byteOrder.Uint32(b[4:])),
+		})
+	}
+
+	wav.PeakChunk = peak
+
+	return nil
+}
+
+// parseCafPeak reads the peak chunk of CAF files, which starts with an edit
+// count and has 64-bit positions.
+func parseCafPeak(r io.Reader, wav *Wav, chunkSize int64) error {
+	if chunkSize < 4 {
+		return fmt.Errorf("%w: peak chunk of %d bytes", ErrChunkSize, chunkSize)
+	}
+
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	peak := &PeakChunk{Version: binary.BigEndian.Uint32(chunk)}
+	for b := chunk[4:]; len(b) >= 12; b = b[12:] {
+		peak.Peaks = append(peak.Peaks, PositionPeak{
+			Value:    math.Float32frombits(binary.BigEndian.Uint32(b)),
+			Position: int64(binary.BigEndian.Uint64(b[4:])),
+		})
+	}
+
+	wav.PeakChunk = peak
+
+	return nil
+}
+
+// measurePeaks updates the measured peaks with a block of samples, which
+// starts at the given position.
+func (p *PeakChunk) measurePeaks(samples [][]float32, position int64) {
+	for ch := range samples {
+		if ch >= len(p.Measured) {
+			break
+		}
+
+		m := &p.Measured[ch]
+		for i, s := range samples[ch] {
+			if s < 0 {
+				s = -s
+			}
+			if s > m.Value {
+				m.Value = s
+				m.Position = position + int64(i)
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package parser
+
+import "math"
+
+// Peaks is the mono downmix of a stream, or its selected channel, reduced
+// to buckets of consecutive samples, keeping the minimum, the maximum and the
+// RMS level of each, which is all it takes to draw a waveform. The number of
+// buckets is bounded: when they run out, neighbouring buckets are merged and
+// their size doubles, so memory doesn't grow with the length of the stream.
+type Peaks struct {
+	BucketSize int64 // in samples per channel; the last bucket can be shorter
+	Min        []float32
+	Max        []float32
+	RMS        []float32
+
+	maxBuckets int
+	sumSquares []float64
+	filled     int64 // number of samples in the last bucket
+}
+
+func newPeaks(maxBuckets int) *Peaks {
+	if maxBuckets < 2 {
+		maxBuckets = 2
+	}
+
+	return &Peaks{BucketSize: 1, maxBuckets: maxBuckets}
+}
+
+// add reduces a block of samples, one slice per channel.
+func (p *Peaks) add(samples [][]float32) {
+	if len(samples) == 0 {
+		return
+	}
+
+	for i := range samples[0] {
+		var sum float32
+		for ch := range samples {
+			sum += samples[ch][i]
+		}
+		p.addSample(sum / float32(len(samples)))
+	}
+}
+
+func (p *Peaks) addSample(s float32) {
+	if len(p.Min) == p.maxBuckets && p.filled == p.BucketSize {
+		p.merge()
+	}
+
+	if len(p.Min) == 0 || p.filled == p.BucketSize {
+		p.Min = append(p.Min, s)
+		p.Max = append(p.Max, s)
+		p.sumSquares = append(p.sumSquares, float64(s)*float64(s))
+		p.filled = 1
+		return
+	}
+
+	last := len(p.Min) - 1
+	if s < p.Min[last] {
+		p.Min[last] = s
+	}
+	if s > p.Max[last] {
+		p.Max[last] = s
+	}
+	p.sumSquares[last] += float64(s) * float64(s)
+	p.filled++
+}
+
+// merge halves the number of buckets by merging them in pairs.
+func (p *Peaks) merge() {
+	n := len(p.Min)
+	for i := 0; i < n/2; i++ {
+		a, b := 2*i, 2*i+1
+		p.Min[i] = min32(p.Min[a], p.Min[b])
+		p.Max[i] = max32(p.Max[a], p.Max[b])
+		p.sumSquares[i] = p.sumSquares[a] + p.sumSquares[b]
+	}
+
+	// an odd bucket out is left half full
+	p.filled = 2 * p.BucketSize
+	if n%2 == 1 {
+		p.Min[n/2] = p.Min[n-1]
+		p.Max[n/2] = p.Max[n-1]
+		p.sumSquares[n/2] = p.sumSquares[n-1]
+		p.filled = p.BucketSize
+	}
+
+	n = (n + 1) / 2
+	p.Min, p.Max, p.sumSquares = p.Min[:n], p.Max[:n], p.sumSquares[:n]
+	p.BucketSize *= 2
+}
+
+// finish computes the RMS levels once all the samples are in.
+func (p *Peaks) finish() {
+	p.RMS = make([]float32, len(p.sumSquares))
+	for i, sum := range p.sumSquares {
+		count := p.BucketSize
+		if i == len(p.sumSquares)-1 {
+			count = p.filled
+		}
+		p.RMS[i] = float32(math.Sqrt(sum / float64(count)))
+	}
+}
+
+// Magnitudes returns the largest absolute value of each bucket.
+func (p *Peaks) Magnitudes() []float32 {
+	magnitudes := make([]float32, len(p.Min))
+	for i := range magnitudes {
+		magnitudes[i] = max32(-p.Min[i], p.Max[i])
+	}
+
+	return magnitudes
+}
+
+// GetPeaks returns the peaks reduced while parsing, see Options.Buckets, or
+// reduces the decoded samples, of the selected channel if any, to at most
+// maxBuckets buckets.
+func (w *Wav) GetPeaks(maxBuckets int) *Peaks {
+	if w.Peaks != nil {
+		return w.Peaks
+	}
+
+	p := newPeaks(maxBuckets)
+	p.add(w.selectedSamples(w.Data))
+	p.finish()
+
+	return p
+}
+
+// appendSamples adds a block of decoded samples, one slice per channel, to
+// Data, or reduces it into Peaks when the samples aren't kept; only the ones
+// in the span are added, when there's one, and only the selected channel is
+// reduced.
+func (w *Wav) appendSamples(samples [][]float32) {
+	if len(samples) == 0 {
+		return
+	}
+
+	position := w.position
+	w.position += int64(len(samples[0]))
+	if w.PeakChunk != nil && w.PeakChunk.Measured != nil {
+		w.PeakChunk.measurePeaks(samples, position)
+	}
+	if w.Span != nil {
+		samples = trimSamples(samples, position, w.Span.Start, w.Span.End)
+	}
+
+	if w.Peaks != nil {
+		w.Peaks.add(w.selectedSamples(samples))
+		return
+	}
+
+	for ch := range samples {
+		w.Data[ch] = append(w.Data[ch], samples[ch]...)
+	}
+}
+
+// trimSamples returns the part of a block of samples, which starts at the
+// given position of the stream, that falls between start and end; a negative
+// end means there's no end.
+func trimSamples(samples [][]float32, position, start, end int64) [][]float32 {
+	if len(samples) == 0 {
+		return samples
+	}
+
+	length := int64(len(samples[0]))
+	from, to := start-position, length
+	if end >= 0 && end-position < to {
+		to = end - position
+	}
+	if from < 0 {
+		from = 0
+	} else if from > length {
+		from = length
+	}
+	if to < from {
+		to = from
+	}
+	if from == 0 && to == length {
+		return samples
+	}
+
+	trimmed := make([][]float32, len(samples))
+	for ch := range samples {
+		trimmed[ch] = samples[ch][from:to]
+	}
+
+	return trimmed
+}
+
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
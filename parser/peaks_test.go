@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestReducingPeaks(t *testing.T) {
+	// 10 stereo samples, reduced to at most 4 buckets, end up in 3 buckets
+	// of 4 samples, the last one holding only 2
+	left := []float32{0, 1, 0, -1, 0.5, 0.5, 0.5, 0.5, 0, -0.5}
+	right := []float32{0, 1, 0, -1, 0.5, 0.5, 0.5, 0.5, 0, 0.5}
+
+	p := newPeaks(4)
+	p.add([][]float32{left[:3], right[:3]})
+	p.add([][]float32{left[3:], right[3:]})
+	p.finish()
+
+	if p.BucketSize != 4 {
+		t.Fatalf("expected buckets of 4 samples, got %d", p.BucketSize)
+	}
+
+	expectedMin := []float32{-1, 0.5, 0}
+	expectedMax := []float32{1, 0.5, 0}
+	expectedRMS := []float32{float32(math.Sqrt(0.5)), 0.5, 0}
+	if len(p.Min) != 3 || len(p.Max) != 3 || len(p.RMS) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(p.Min))
+	}
+	for i := range expectedMin {
+		if p.Min[i] != expectedMin[i] || p.Max[i] != expectedMax[i] || math.Abs(float64(p.RMS[i]-expectedRMS[i])) > 1e-6 {
+			t.Errorf("bucket %d: expected %v/%v/%v, got %v/%v/%v", i, expectedMin[i], expectedMax[i], expectedRMS[i], p.Min[i], p.Max[i], p.RMS[i])
+		}
+	}
+}
+
+func TestParsingWithPeaks(t *testing.T) {
+	data, err := os.ReadFile("../test-files/2ch-48000-16bit-signed.wav")
+	if err != nil {
+		t.Fatalf("failed reading the file: %v", err)
+	}
+
+	wav, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	expected := wav.GetPeaks(1000)
+
+	reduced, err := ParseWithOptions(bytes.NewReader(data), Options{Buckets: 1000})
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	if len(reduced.Data[0]) != 0 {
+		t.Errorf("expected no samples to be kept, got %d", len(reduced.Data[0]))
+	}
+	if reduced.GetNumSamples() != wav.GetNumSamples() {
+		t.Errorf("expected %d samples, got %d", wav.GetNumSamples(), reduced.GetNumSamples())
+	}
+
+	peaks := reduced.Peaks
+	if peaks == nil || len(peaks.Min) > 1000 || int64(len(peaks.Min))*peaks.BucketSize < wav.GetNumSamples() {
+		t.Fatalf("unexpected peaks: %+v", peaks)
+	}
+	if peaks.BucketSize != expected.BucketSize || len(peaks.Min) != len(expected.Min) {
+		t.Fatalf("expected %d buckets of %d samples, got %d of %d", len(expected.Min), expected.BucketSize, len(peaks.Min), peaks.BucketSize)
+	}
+	for i := range peaks.Min {
+		if peaks.Min[i] != expected.Min[i] || peaks.Max[i] != expected.Max[i] || peaks.RMS[i] != expected.RMS[i] {
+			t.Fatalf("bucket %d differs from the one reduced from the decoded samples", i)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package parser
+
+import "strings"
+
+// Picture is an image embedded in a file, like its cover art, from an ID3v2
+// APIC frame.
+type Picture struct {
+	Type        byte   // what it shows, see GetTypeName
+	MIMEType    string // e.g. "image/jpeg"; "-->" when Data is a URL instead
+	Description string
+	Data        []byte
+}
+
+// pictureTypes are the names of the ID3v2 picture types.
+var pictureTypes = []string{
+	"other", "file icon", "other file icon", "front cover", "back cover",
+	"leaflet page", "media", "lead artist", "artist", "conductor", "band",
+	"composer", "lyricist", "recording location", "during recording",
+	"during performance", "screen capture", "bright coloured fish",
+	"illustration", "band logotype", "publisher logotype",
+}
+
+const pictureFrontCover = 3
+
+func (p *Picture) GetTypeName() string {
+	if int(p.Type) < len(pictureTypes) {
+		return pictureTypes[p.Type]
+	}
+
+	return "unknown"
+}
+
+// IsImage reports whether the picture holds the image itself, rather than a
+// link to it.
+func (p *Picture) IsImage() bool {
+	return strings.HasPrefix(p.MIMEType, "image/") && len(p.Data) > 0
+}
+
+// GetCoverArt returns the front cover or, if there's none, the first of the
+// embedded images; it returns nil when there are no images.
+func (w *Wav) GetCoverArt() *Picture {
+	var cover *Picture
+	for i := range w.Pictures {
+		p := &w.Pictures[i]
+		if !p.IsImage() {
+			continue
+		}
+		if p.Type == pictureFrontCover {
+			return p
+		}
+		if cover == nil {
+			cover = p
+		}
+	}
+
+	return cover
+}
+
+// imageMIMEType turns the image formats of ID3v2.2, like "JPG", and the
+// usual misspellings of the MIME types into proper MIME types.
+func imageMIMEType(format string) string {
+	format = strings.ToLower(format)
+	if format == "-->" {
+		return format
+	}
+
+	format = strings.TrimPrefix(format, "image/")
+	if format == "jpg" {
+		format = "jpeg"
+	}
+
+	return "image/" + format
+}
@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RawFormat describes the samples of a headerless PCM stream, which has to
+// be declared since nothing in the stream tells it.
+type RawFormat struct {
+	SampleRate    int
+	NumChannels   int
+	BitsPerSample int // 8, 16, 24 or 32 for integers, 32 or 64 for floats
+	Unsigned      bool
+	BigEndian     bool
+	Float         bool
+}
+
+// ParseRawFormat reads a format written as <encoding>:<rate>:<channels>,
+// where the encoding is spelled like ffmpeg's sample formats: s for signed
+// integers, u for unsigned ones or f for floats, followed by the bit depth and
+// by le or be for the byte order, e.g. "s16le:44100:2" or "f32be:48000:1".
+// The byte order can be left out, in which case it's little-endian.
+func ParseRawFormat(s string) (RawFormat, error) {
+	var format RawFormat
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return format, fmt.Errorf("invalid raw format %q: expected <encoding>:<rate>:<channels>", s)
+	}
+
+	encoding := strings.ToLower(parts[0])
+	if strings.HasSuffix(encoding, "be") {
+		format.BigEndian = true
+		encoding = strings.TrimSuffix(encoding, "be")
+	} else {
+		encoding = strings.TrimSuffix(encoding, "le")
+	}
+
+	if encoding == "" {
+		return format, fmt.Errorf("invalid raw format %q: missing encoding", s)
+	}
+	switch encoding[0] {
+	case 's':
+	case 'u':
+		format.Unsigned = true
+	case 'f':
+		format.Float = true
+	default:
+		return format, fmt.Errorf("invalid raw format %q: unknown encoding %q", s, parts[0])
+	}
+
+	var err error
+	if format.BitsPerSample, err = strconv.Atoi(encoding[1:]); err != nil {
+		return format, fmt.Errorf("invalid raw format %q: unknown encoding %q", s, parts[0])
+	}
+	if format.SampleRate, err = strconv.Atoi(parts[1]); err != nil {
+		return format, fmt.Errorf("invalid raw format %q: invalid sample rate %q", s, parts[1])
+	}
+	if format.NumChannels, err = strconv.Atoi(parts[2]); err != nil {
+		return format, fmt.Errorf("invalid raw format %q: invalid channel count %q", s, parts[2])
+	}
+
+	return format, format.validate()
+}
+
+func (f RawFormat) validate() error {
+	if f.SampleRate <= 0 {
+		return fmt.Errorf("invalid raw format: the sample rate must be positive, not %d", f.SampleRate)
+	}
+
+	if f.Float {
+		if f.Unsigned {
+			return fmt.Errorf("invalid raw format: floats can't be unsigned")
+		}
+		if f.BitsPerSample != 32 && f.BitsPerSample != 64 {
+			return fmt.Errorf("invalid raw format: floats must be 32 or 64-bit, not %d-bit", f.BitsPerSample)
+		}
+	} else if f.BitsPerSample != 8 && f.BitsPerSample != 16 && f.BitsPerSample != 24 && f.BitsPerSample != 32 {
+		return fmt.Errorf("invalid raw format: integers must be 8, 16, 24 or 32-bit, not %d-bit", f.BitsPerSample)
+	}
+
+	// the frame size, and the byte rate, have to fit in the fields of a WAVE
+	// header
+	if f.NumChannels <= 0 || f.NumChannels > math.MaxInt16/(f.BitsPerSample/8) {
+		return fmt.Errorf("invalid raw format: invalid channel count %d", f.NumChannels)
+	}
+	frameSize := f.NumChannels * f.BitsPerSample / 8
+	if f.SampleRate > math.MaxInt32/frameSize {
+		return fmt.Errorf("invalid raw format: the sample rate %d is too high for %d-byte frames", f.SampleRate, frameSize)
+	}
+
+	return nil
+}
+
+// ParseRaw decodes a headerless PCM stream read from r, whose samples are
+// interleaved and laid out as described by format, until EOF.
+func ParseRaw(r io.Reader, format RawFormat) (*Wav, error) {
+	return ParseRawWithOptions(r, format, Options{})
+}
+
+// ParseRawWithOptions is ParseRaw with the options of ParseWithOptions.
+func ParseRawWithOptions(r io.Reader, format RawFormat, options Options) (*Wav, error) {
+	if err := format.validate(); err != nil {
+		return nil, err
+	}
+	if err := checkRange(options); err != nil {
+		return nil, err
+	}
+
+	var wav Wav
+	if n, ok := r.(interface{ Name() string }); ok {
+		wav.Name = n.Name()
+	}
+	if options.Buckets > 0 && !options.HeaderOnly {
+		wav.Peaks = newPeaks(options.Buckets)
+	}
+
+	wav.AudioFormat = FormatPCM
+	if format.Float {
+		wav.AudioFormat = FormatIEEEFloat
+	}
+	wav.NumChannels = int16(format.NumChannels)
+	wav.SampleRate = int32(format.SampleRate)
+	wav.BitsPerSample = int16(format.BitsPerSample)
+	wav.BlockAlign = wav.NumChannels * wav.BitsPerSample / 8
+	wav.ByteRate = wav.SampleRate * int32(wav.BlockAlign)
+	wav.Signed = !format.Unsigned
+
+	wav.ByteOrder = binary.LittleEndian
+	if format.BigEndian {
+		wav.ByteOrder = binary.BigEndian
+	}
+
+	// the samples run until EOF, like the data of streamed WAVE files
+	cr := newChunkReader(r)
+	wav.Subchunk2Size = unknownSize
+	if err := readData(cr, &wav, options); err != nil {
+		// like the data chunk of a damaged file, what was read can be kept
+		if err := wav.salvage(fmt.Errorf("parse error: %w", err), options); err != nil {
+			return nil, channelError(err)
+		}
+	}
+	if err := wav.closeSpan(); err != nil {
+		return nil, err
+	}
+	if wav.Peaks != nil {
+		wav.Peaks.finish()
+	}
+
+	// GetFileSize adds the 8 bytes of a RIFF chunk header
+	wav.ChunkSize = cr.offset - 8
+
+	return &wav, nil
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestParsingRawFormats(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected RawFormat
+	}{
+		{"s16le:44100:2", RawFormat{SampleRate: 44100, NumChannels: 2, BitsPerSample: 16}},
+		{"u8:8000:1", RawFormat{SampleRate: 8000, NumChannels: 1, BitsPerSample: 8, Unsigned: true}},
+		{"F64BE:96000:6", RawFormat{SampleRate: 96000, NumChannels: 6, BitsPerSample: 64, BigEndian: true, Float: true}},
+	}
+
+	for _, test := range tests {
+		format, err := ParseRawFormat(test.spec)
+		if err != nil {
+			t.Errorf("failed parsing %q: %v", test.spec, err)
+		} else if format != test.expected {
+			t.Errorf("%q: expected %+v does not equal given %+v", test.spec, test.expected, format)
+		}
+	}
+
+	for _, spec := range []string{"s16le:44100", "x16le:44100:2", "s12le:44100:2", "u32le:0:2", "f16le:44100:2", "s16le:44100:0", "f64le:44100:32767", "s32le:2147483647:2"} {
+		if _, err := ParseRawFormat(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestParsingRaw(t *testing.T) {
+	tests := []struct {
+		format   RawFormat
+		data     []byte
+		expected []float32
+	}{
+		{RawFormat{BitsPerSample: 8, Unsigned: true}, []byte{0x40, 0xc0, 0x80, 0x00}, []float32{-0.5, 0.5, 0, -1}},
+		{RawFormat{BitsPerSample: 16, Unsigned: true, BigEndian: true}, []byte{0x40, 0x00, 0xc0, 0x00, 0x80, 0x00, 0x00, 0x00}, []float32{-0.5, 0.5, 0, -1}},
+		{RawFormat{BitsPerSample: 24, Unsigned: true}, []byte{0, 0, 0x40, 0, 0, 0xc0, 0, 0, 0x80, 0, 0, 0}, []float32{-0.5, 0.5, 0, -1}},
+		{RawFormat{BitsPerSample: 32, Unsigned: true}, []byte{0, 0, 0, 0x40, 0, 0, 0, 0xc0, 0, 0, 0, 0x80, 0, 0, 0, 0}, []float32{-0.5, 0.5, 0, -1}},
+		{RawFormat{BitsPerSample: 24, BigEndian: true}, []byte{0xc0, 0, 0, 0x40, 0, 0, 0, 0, 0, 0x80, 0, 0}, []float32{-0.5, 0.5, 0, -1}},
+		{RawFormat{BitsPerSample: 32, Float: true}, []byte{0, 0, 0x80, 0x3e, 0, 0, 0x80, 0xbe}, []float32{0.25, -0.25}},
+	}
+
+	for _, test := range tests {
+		test.format.SampleRate = 8000
+		test.format.NumChannels = 2
+
+		wav, err := ParseRaw(bytes.NewReader(test.data), test.format)
+		if err != nil {
+			t.Fatalf("failed parsing %+v: %v", test.format, err)
+		}
+		if err := wav.CheckFormat(); err != nil {
+			t.Fatalf("validation failed: %v", err)
+		}
+
+		if n := wav.GetNumSamples(); n != int64(len(test.expected)/2) {
+			t.Errorf("%+v: expected %d samples, given %d", test.format, len(test.expected)/2, n)
+		}
+		for i, s := range test.expected {
+			if given := wav.Data[i%2][i/2]; given != s {
+				t.Errorf("%+v: expected %f does not equal given %f", test.format, s, given)
+			}
+		}
+	}
+}
+
+func TestParsingRawPartialFrame(t *testing.T) {
+	format := RawFormat{SampleRate: 8000, NumChannels: 2, BitsPerSample: 16}
+	// two frames, and the first byte of a third one
+	data := []byte{0, 0x40, 0, 0xc0, 0, 0, 0, 0x80, 1}
+
+	for _, options := range []Options{{}, {HeaderOnly: true}} {
+		if _, err := ParseRawWithOptions(bytes.NewReader(data), format, options); !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected a truncation error, given %v", err)
+		}
+
+		options.Lenient = true
+		wav, err := ParseRawWithOptions(bytes.NewReader(data), format, options)
+		if err != nil {
+			t.Fatalf("failed parsing: %v", err)
+		}
+		if wav.GetNumSamples() != 2 || len(wav.Problems) != 1 || !errors.Is(wav.Problems[0], ErrTruncated) {
+			t.Errorf("expected the 2 whole frames and a problem, given %d samples and %v", wav.GetNumSamples(), wav.Problems)
+		}
+		if !options.HeaderOnly && (len(wav.Data[1]) != 2 || wav.Data[1][1] != -1) {
+			t.Errorf("unexpected samples %v", wav.Data)
+		}
+	}
+}
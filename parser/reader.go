@@ -0,0 +1,156 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// chunkReader buffers the reads from the underlying reader and, when that
+// reader can seek, skips unneeded chunks by seeking over them instead of
+// reading them.
+type chunkReader struct {
+	*bufio.Reader
+	src    io.Reader
+	seeker io.Seeker
+	offset int64 // number of bytes consumed so far
+}
+
+func newChunkReader(r io.Reader) *chunkReader {
+	cr := &chunkReader{
+		Reader: bufio.NewReader(r),
+		src:    r,
+	}
+	if s, ok := r.(io.Seeker); ok {
+		// stdin and pipes implement io.Seeker too but fail when called,
+		// so only use seeking if it actually works
+		if _, err := s.Seek(0, io.SeekCurrent); err == nil {
+			cr.seeker = s
+		}
+	}
+
+	return cr
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	cr.offset += int64(n)
+
+	return n, err
+}
+
+func (cr *chunkReader) ReadByte() (byte, error) {
+	b, err := cr.Reader.ReadByte()
+	if err == nil {
+		cr.offset++
+	}
+
+	return b, err
+}
+
+// skip discards the next n bytes.
+func (cr *chunkReader) skip(n int64) error {
+	if n < 0 {
+		// a corrupt size, which mustn't send the reader back
+		return ErrChunkSize
+	}
+
+	buffered := int64(cr.Buffered())
+	if cr.seeker != nil && n > buffered {
+		// seeking past the end succeeds, so the input is cut short like
+		// it'd be when reading through it
+		if left, ok := cr.remaining(); ok && n > left {
+			if err := cr.skip(left); err != nil {
+				return err
+			}
+			return io.ErrUnexpectedEOF
+		}
+
+		if _, err := cr.seeker.Seek(n-buffered, io.SeekCurrent); err != nil {
+			return err
+		}
+		cr.Reset(cr.src)
+		cr.offset += n
+
+		return nil
+	}
+
+	discarded, err := io.CopyN(io.Discard, cr.Reader, n)
+	cr.offset += discarded
+	if err == io.EOF && discarded < n {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// remaining returns the number of bytes left, when the reader can seek.
+func (cr *chunkReader) remaining() (int64, bool) {
+	if cr.seeker == nil {
+		return 0, false
+	}
+
+	current, err := cr.seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	end, err := cr.seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false
+	}
+	if _, err := cr.seeker.Seek(current, io.SeekStart); err != nil {
+		return 0, false
+	}
+
+	// the reader may have been left past the end
+	left := end - current + int64(cr.Buffered())
+	if left < 0 {
+		left = 0
+	}
+
+	return left, true
+}
+
+// skipToEnd discards everything left, returning the number of bytes.
+func (cr *chunkReader) skipToEnd() (int64, error) {
+	if n, ok := cr.remaining(); ok {
+		return n, cr.skip(n)
+	}
+
+	n, err := io.Copy(io.Discard, cr.Reader)
+	cr.offset += n
+
+	return n, err
+}
+
+// maxPreallocatedChunk is the size up to which readChunk trusts chunk sizes
+// enough to allocate them upfront.
+const maxPreallocatedChunk = 1 << 20
+
+// readChunk reads the body of a chunk. A corrupt chunk can claim to be
+// gigabytes long, so big chunks are only allocated as their bytes come in,
+// which stops at the end of the input.
+func readChunk(r io.Reader, size int64) ([]byte, error) {
+	if size < 0 {
+		return nil, ErrChunkSize
+	}
+
+	if size <= maxPreallocatedChunk {
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+
+		return chunk, nil
+	}
+
+	var chunk bytes.Buffer
+	if _, err := io.CopyN(&chunk, r, size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return chunk.Bytes(), nil
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Sampler holds the smpl chunk, which describes how a sampler should play the
+// file back.
+type Sampler struct {
+	Manufacturer      uint32
+	Product           uint32
+	SamplePeriod      uint32 // in nanoseconds
+	MIDIUnityNote     uint32
+	MIDIPitchFraction uint32
+	SMPTEFormat       uint32
+	SMPTEOffset       uint32
+	Loops             []SampleLoop
+}
+
+type SampleLoop struct {
+	CuePointID uint32
+	Type       uint32
+	Start      uint32 // in samples per channel
+	End        uint32 // in samples per channel, inclusive
+	Fraction   uint32
+	PlayCount  uint32 // 0 means infinite
+}
+
+// Loop types, as found in SampleLoop.Type; the other values are sampler specific.
+const (
+	LoopForward  uint32 = 0
+	LoopPingPong uint32 = 1
+	LoopBackward uint32 = 2
+)
+
+func (l *SampleLoop) GetTypeName() string {
+	switch l.Type {
+	case LoopForward:
+		return "forward"
+	case LoopPingPong:
+		return "ping-pong"
+	case LoopBackward:
+		return "backward"
+	default:
+		return fmt.Sprintf("type %d", l.Type)
+	}
+}
+
+// Instrument holds the inst chunk.
+type Instrument struct {
+	UnshiftedNote uint8
+	FineTune      int8 // in cents
+	Gain          int8 // in dB
+	LowNote       uint8
+	HighNote      uint8
+	LowVelocity   uint8
+	HighVelocity  uint8
+}
+
+var noteNames = [12]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// GetNoteName returns the name of a MIDI note, where 60 is C4 (middle C).
+func GetNoteName(note uint32) string {
+	return fmt.Sprintf("%s%d", noteNames[note%12], int(note/12)-1)
+}
+
+func parseSmpl(r io.Reader, wav *Wav, chunkSize int64) error {
+	const headerSize, loopSize = 36, 24
+
+	if chunkSize < headerSize {
+		return fmt.Errorf("%w: smpl chunk of %d bytes", ErrChunkSize, chunkSize)
+	}
+
+	chunk, err := readChunk(r, chunkSize)
+	if err != nil {
+		return err
+	}
+
+	var header struct {
+		Manufacturer      uint32
+		Product           uint32
+		SamplePeriod      uint32
+		MIDIUnityNote     uint32
+		MIDIPitchFraction uint32
+		SMPTEFormat       uint32
+		SMPTEOffset       uint32
+		NumSampleLoops    uint32
+		SamplerData       uint32
+	}
+	br := bytes.NewReader(chunk)
+	if err := binary.Read(br, wav.byteOrder(), &header); err != nil {
+		return err
+	}
+
+	sampler := &Sampler{
+		Manufacturer:      header.Manufacturer,
+		Product:           header.Product,
+		SamplePeriod:      header.SamplePeriod,
+		MIDIUnityNote:     header.MIDIUnityNote,
+		MIDIPitchFraction: header.MIDIPitchFraction,
+		SMPTEFormat:       header.SMPTEFormat,
+		SMPTEOffset:       header.SMPTEOffset,
+	}
+
+	numLoops := int64(header.NumSampleLoops)
+	if max := (chunkSize - headerSize) / loopSize; numLoops > max {
+		numLoops = max
+	}
+	sampler.Loops = make([]SampleLoop, numLoops)
+	if err := binary.Read(br, wav.byteOrder(), sampler.Loops); err != nil {
+		return err
+	}
+
+	wav.Sampler = sampler
+
+	return nil
+}
+
+func parseInst(r io.Reader, wav *Wav, chunkSize int64) error {
+	if chunkSize < 7 {
+		return fmt.Errorf("%w: inst chunk of %d bytes", ErrChunkSize, chunkSize)
+	}
+
+	var inst Instrument
+	if err := binary.Read(r, binary.LittleEndian, &inst); err != nil {
+		return err
+	}
+	wav.Instrument = &inst
+
+	// the chunk is 7 bytes long, but some writers add more
+	_, err := io.CopyN(io.Discard, r, chunkSize-7)
+
+	return err
+}
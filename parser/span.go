@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"fmt"
+	"time"
+)
+
+// Span is a range of samples per channel, from Start up to End, excluded.
+type Span struct {
+	Start int64
+	End   int64
+}
+
+// Len returns the number of samples in the span.
+func (s Span) Len() int64 {
+	return s.End - s.Start
+}
+
+// GetSpan returns the range of samples that was decoded, which is the whole
+// stream unless it was parsed with Options.Start or Options.End.
+func (w *Wav) GetSpan() Span {
+	if w.Span != nil {
+		return *w.Span
+	}
+
+	return Span{End: w.GetNumSamples()}
+}
+
+// checkRange rejects the time ranges that can't select anything.
+func checkRange(options Options) error {
+	if options.Start < 0 || options.End < 0 || options.End > 0 && options.End <= options.Start {
+		return fmt.Errorf("invalid range from %v to %v", options.Start, options.End)
+	}
+
+	return nil
+}
+
+// selectSpan converts the time range of the options to samples, once the
+// sample rate is known; the end is left open, as -1, when the range runs to
+// the end of the stream.
+func (w *Wav) selectSpan(options Options) {
+	if options.Start == 0 && options.End == 0 {
+		return
+	}
+
+	w.Span = &Span{Start: w.toSamples(options.Start), End: -1}
+	if options.End > 0 {
+		w.Span.End = w.toSamples(options.End)
+	}
+}
+
+func (w *Wav) toSamples(d time.Duration) int64 {
+	rate := int64(w.SampleRate)
+
+	// split in two so that long durations can't overflow
+	return int64(d/time.Second)*rate + int64(d%time.Second)*rate/int64(time.Second)
+}
+
+// closeSpan fits the span to the length of the stream once it's been read.
+func (w *Wav) closeSpan() error {
+	if w.Span == nil {
+		return nil
+	}
+
+	numSamples := w.GetNumSamples()
+	if w.Span.End < 0 || w.Span.End > numSamples {
+		w.Span.End = numSamples
+	}
+	if w.Span.Start >= w.Span.End {
+		return fmt.Errorf("parse error: the range selects none of the %d samples of the stream", numSamples)
+	}
+
+	return nil
+}
+
+// spanDone reports whether the decoders are past the end of the span, and so
+// only need to find out the length of the stream.
+func (w *Wav) spanDone() bool {
+	return w.Span != nil && w.Span.End >= 0 && w.position >= w.Span.End
+}
+
+// skipFrames skips up to n frames, or blocks, of the given size, stopping at
+// the end of the input when its size is known; it returns the number of
+// frames skipped.
+func skipFrames(cr *chunkReader, n, frameSize int64) (int64, error) {
+	if remaining, ok := cr.remaining(); ok && n*frameSize > remaining {
+		n = remaining / frameSize
+	}
+
+	from := cr.offset
+	err := cr.skip(n * frameSize)
+
+	return (cr.offset - from) / frameSize, err
+}
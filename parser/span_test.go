@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// checkSpan parses data with the given range, from both a seekable and a
+// plain reader, comparing the samples to those of the whole stream.
+func checkSpan(t *testing.T, name string, data []byte, full *Wav, start, end time.Duration, expected Span) {
+	for _, r := range []io.Reader{bytes.NewReader(data), io.MultiReader(bytes.NewReader(data))} {
+		wav, err := ParseWithOptions(r, Options{Start: start, End: end})
+		if err != nil {
+			t.Fatalf("%s: failed parsing from %v to %v: %v", name, start, end, err)
+		}
+
+		if wav.Span == nil || *wav.Span != expected {
+			t.Fatalf("%s: expected the span %+v, given %+v", name, expected, wav.Span)
+		}
+		if wav.GetNumSamples() != full.GetNumSamples() {
+			t.Errorf("%s: expected %d samples in the stream, given %d", name, full.GetNumSamples(), wav.GetNumSamples())
+		}
+
+		for c := range full.Data {
+			if int64(len(wav.Data[c])) != expected.Len() {
+				t.Fatalf("%s: expected %d samples on channel %d, given %d", name, expected.Len(), c, len(wav.Data[c]))
+			}
+			for i, s := range wav.Data[c] {
+				if s != full.Data[c][expected.Start+int64(i)] {
+					t.Fatalf("%s: sample %d on channel %d differs", name, expected.Start+int64(i), c)
+				}
+			}
+		}
+	}
+}
+
+func TestParsingSpan(t *testing.T) {
+	data, err := os.ReadFile("../test-files/2ch-48000-16bit-signed.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	numSamples := full.GetNumSamples()
+
+	// the same file, as if it had been written to a pipe
+	streamed := append([]byte(nil), data...)
+	dataChunk := bytes.Index(streamed, []byte("data"))
+	binary.LittleEndian.PutUint32(streamed[dataChunk+4:], unknownSize)
+
+	for _, input := range []struct {
+		name string
+		data []byte
+	}{{"sized", data}, {"streamed", streamed}} {
+		checkSpan(t, input.name, input.data, full, time.Second, 2*time.Second, Span{48000, 96000})
+		checkSpan(t, input.name, input.data, full, 4*time.Second, 0, Span{192000, numSamples})
+		checkSpan(t, input.name, input.data, full, 0, 500*time.Millisecond, Span{0, 24000})
+		checkSpan(t, input.name, input.data, full, time.Second, time.Hour, Span{48000, numSamples})
+	}
+
+	if _, err := ParseWithOptions(bytes.NewReader(data), Options{Start: time.Hour}); err == nil {
+		t.Errorf("expected an error for a range past the end")
+	}
+	if _, err := ParseWithOptions(bytes.NewReader(data), Options{Start: 2 * time.Second, End: time.Second}); err == nil {
+		t.Errorf("expected an error for a range that ends before it starts")
+	}
+
+	header, err := ParseWithOptions(bytes.NewReader(data), Options{HeaderOnly: true, Start: time.Second})
+	if err != nil {
+		t.Fatalf("failed parsing the header: %v", err)
+	}
+	if header.GetSpan() != (Span{48000, numSamples}) {
+		t.Errorf("unexpected span %+v", header.GetSpan())
+	}
+}
+
+func TestParsingADPCMSpan(t *testing.T) {
+	// 5 blocks of 9 IMA ADPCM samples at 1 kHz, of which the fact chunk
+	// only keeps 40
+	var blocks []byte
+	for i := 0; i < 5; i++ {
+		blocks = append(blocks, byte(i), 0, 0, 0, 0x17, 0x71, byte(i), 0x25)
+	}
+	data := makeRiff(
+		makeChunk("fmt ", FormatIMAADPCM, int16(1), int32(1000), int32(889), int16(8), int16(4), int16(2), int16(9)),
+		makeChunk("fact", uint32(40)),
+		makeChunk("data", blocks),
+	)
+
+	full, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	if full.GetNumSamples() != 40 {
+		t.Fatalf("expected 40 samples, given %d", full.GetNumSamples())
+	}
+
+	checkSpan(t, "adpcm", data, full, 12*time.Millisecond, 30*time.Millisecond, Span{12, 30})
+	checkSpan(t, "adpcm", data, full, 20*time.Millisecond, 0, Span{20, 40})
+}
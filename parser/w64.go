@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// w64GUIDSuffix is the part shared by the GUIDs of the Wave64 chunks that
+// have a RIFF counterpart, following its four-character ID.
+var w64GUIDSuffix = [12]byte{0xf3, 0xac, 0xd3, 0x11, 0x8c, 0xd1, 0x00, 0xc0, 0x4f, 0x8e, 0xdb, 0x8a}
+
+// the GUIDs of the riff and list chunks don't follow that pattern
+var (
+	w64RiffGUID = [16]byte{'r', 'i', 'f', 'f', 0x2e, 0x91, 0xcf, 0x11, 0xa5, 0xd6, 0x28, 0xdb, 0x04, 0xc1, 0x00, 0x00}
+	w64ListGUID = [16]byte{'l', 'i', 's', 't', 0x2f, 0x91, 0xcf, 0x11, 0xa5, 0xd6, 0x28, 0xdb, 0x04, 0xc1, 0x00, 0x00}
+)
+
+// w64ChunkID maps the GUID of a Wave64 chunk to the ID of the matching RIFF
+// chunk, reporting false for the GUIDs it doesn't know.
+func w64ChunkID(guid [16]byte) ([4]byte, bool) {
+	if guid == w64ListGUID {
+		return [4]byte{'L', 'I', 'S', 'T'}, true
+	}
+
+	var id [4]byte
+	copy(id[:], guid[:4])
+
+	return id, bytes.Equal(guid[4:], w64GUIDSuffix[:])
+}
+
+// parseW64 reads a Sony Wave64 file, which is a WAVE file with GUIDs for
+// chunk IDs, 64-bit chunk sizes that include the chunk headers, and chunks
+// aligned to 8 bytes.
+func parseW64(cr *chunkReader, wav *Wav, options Options) error {
+	wav.ByteOrder = binary.LittleEndian
+
+	var header struct {
+		GUID   [16]byte
+		Size   uint64
+		Format [16]byte
+	}
+	if err := binary.Read(cr, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+	if header.GUID != w64RiffGUID {
+		return fmt.Errorf("%w: not a Wave64 file", ErrUnrecognized)
+	}
+	if id, ok := w64ChunkID(header.Format); !ok || string(id[:]) != "wave" {
+		return fmt.Errorf("%w: not a Wave64 file", ErrUnrecognized)
+	}
+
+	copy(wav.ChunkID[:], header.GUID[:4])
+	copy(wav.Format[:], header.Format[:4])
+	// GetFileSize adds the 8 bytes of a RIFF chunk header
+	wav.ChunkSize = int64(header.Size) - 8
+
+	for {
+		offset := cr.offset
+
+		var guid [16]byte
+		var chunkSize uint64
+		if err := binary.Read(cr, binary.LittleEndian, &guid); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err := wav.salvage(fmt.Errorf("failed reading the chunk ID: %w", truncated(err)), options); err != nil {
+				return err
+			}
+			break
+		}
+		if err := binary.Read(cr, binary.LittleEndian, &chunkSize); err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err := wav.salvage(fmt.Errorf("failed reading the chunk size: %w", truncated(err)), options); err != nil {
+				return err
+			}
+			break
+		}
+
+		chunkID, ok := w64ChunkID(guid)
+		chunkIDStr := string(chunkID[:])
+		if chunkSize < 24 || chunkSize > math.MaxInt64 {
+			// there's no telling where the next chunk starts
+			if err := wav.salvage(chunkError(chunkIDStr, offset, ErrChunkSize), options); err != nil {
+				return err
+			}
+			break
+		}
+
+		size := int64(chunkSize) - 24
+		last := false
+		if options.Lenient {
+			size, last = clampChunkSize(cr, wav, chunkIDStr, offset, size)
+		}
+
+		var err error
+		if !ok {
+			err = cr.skip(size)
+		} else if chunkIDStr == "fact" {
+			err = parseW64Fact(cr, wav, size)
+		} else {
+			err = parseWaveChunk(cr, wav, chunkID, size, options)
+		}
+		if err != nil {
+			if err := wav.salvage(chunkError(chunkIDStr, offset, err), options); err != nil {
+				return err
+			}
+			if !skipPastChunk(cr, offset+24+size) {
+				break
+			}
+		}
+
+		if last {
+			break
+		}
+
+		if padding := -chunkSize & 7; padding != 0 {
+			if err := cr.skip(int64(padding)); err != nil && err != io.ErrUnexpectedEOF {
+				return fmt.Errorf("parse error: %w", err)
+			}
+		}
+	}
+
+	if wav.Subchunk1ID == [4]byte{} {
+		return fmt.Errorf("parse error: %w", ErrMissingFmt)
+	}
+
+	return nil
+}
+
+// parseW64Fact reads the fact chunk, whose sample count, unlike in WAVE
+// files, has 64 bits.
+func parseW64Fact(cr *chunkReader, wav *Wav, size int64) error {
+	if size < 8 {
+		return ErrChunkSize
+	}
+
+	var sampleLength uint64
+	if err := binary.Read(cr, binary.LittleEndian, &sampleLength); err != nil {
+		return err
+	}
+	wav.SampleLength = int64(sampleLength)
+
+	return cr.skip(size - 8)
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func makeW64Chunk(guid [16]byte, payload []byte) []byte {
+	var chunk bytes.Buffer
+	chunk.Write(guid[:])
+	_ = binary.Write(&chunk, binary.LittleEndian, uint64(24+len(payload)))
+	chunk.Write(payload)
+	for chunk.Len()%8 != 0 {
+		chunk.WriteByte(0)
+	}
+
+	return chunk.Bytes()
+}
+
+func w64GUID(id string) [16]byte {
+	var guid [16]byte
+	copy(guid[:], id)
+	copy(guid[4:], w64GUIDSuffix[:])
+
+	return guid
+}
+
+func TestParsingW64(t *testing.T) {
+	var fmtChunk bytes.Buffer
+	_ = binary.Write(&fmtChunk, binary.LittleEndian, []int16{int16(FormatPCM), 2})
+	_ = binary.Write(&fmtChunk, binary.LittleEndian, []int32{48000, 48000 * 4})
+	_ = binary.Write(&fmtChunk, binary.LittleEndian, []int16{4, 16})
+
+	var samples bytes.Buffer
+	_ = binary.Write(&samples, binary.LittleEndian, []int16{-16384, 16384, 0, -32768, 8192, 0})
+
+	// an odd-sized INFO list, followed by padding
+	info := []byte("INFOINAM\x05\x00\x00\x00Take\x00\x00")
+
+	var body bytes.Buffer
+	wave := w64GUID("wave")
+	body.Write(wave[:])
+	body.Write(makeW64Chunk(w64GUID("fmt "), fmtChunk.Bytes()))
+	body.Write(makeW64Chunk(w64ListGUID, info[:len(info)-1]))
+	body.Write(makeW64Chunk(w64GUID("data"), samples.Bytes()))
+
+	var w64 bytes.Buffer
+	w64.Write(w64RiffGUID[:])
+	_ = binary.Write(&w64, binary.LittleEndian, uint64(24+body.Len()))
+	w64.Write(body.Bytes())
+
+	wav, err := Parse(bytes.NewReader(w64.Bytes()))
+	if err != nil {
+		t.Fatalf("failed parsing: %v", err)
+	}
+	if err := wav.CheckFormat(); err != nil {
+		t.Fatalf("validation failed: %v", err)
+	}
+
+	if wav.SampleRate != 48000 || wav.NumChannels != 2 || wav.BitsPerSample != 16 {
+		t.Errorf("unexpected format: %d Hz, %d channels, %d-bit", wav.SampleRate, wav.NumChannels, wav.BitsPerSample)
+	}
+	if wav.GetNumSamples() != 3 {
+		t.Errorf("expected 3 samples, given %d", wav.GetNumSamples())
+	}
+	if wav.GetFileSize() != int64(w64.Len()) {
+		t.Errorf("expected a file size of %d, given %d", w64.Len(), wav.GetFileSize())
+	}
+
+	expected := [][]float32{{-0.5, 0, 0.25}, {0.5, -1, 0}}
+	for c := range expected {
+		for i := range expected[c] {
+			if wav.Data[c][i] != expected[c][i] {
+				t.Errorf("expected %f does not equal given %f", expected[c][i], wav.Data[c][i])
+			}
+		}
+	}
+
+	if wav.Metadata["title"] != "Take" {
+		t.Errorf("expected the Take title, given %q", wav.Metadata["title"])
+	}
+}
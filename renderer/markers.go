@@ -0,0 +1,143 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+	"wav/parser"
+)
+
+// markerSpan is a marker's position along a waveform that is drawn over a
+// given width; regions and loops also have a width.
+type markerSpan struct {
+	X     float64
+	Width float64
+	Label string
+	Class string // marker, region or loop
+	Color string
+}
+
+// getMarkerSpans returns the cue points and regions and, if the overlay asks
+// for them, the sampler loops, as far as they fall in the decoded span.
+func getMarkerSpans(wav *parser.Wav, overlay Overlay, width int) []markerSpan {
+	decoded := wav.GetSpan()
+	numSamples := decoded.Len()
+	if numSamples <= 0 {
+		return nil
+	}
+
+	toWidth := func(samples int64) float64 {
+		return math.Round(float64(samples) / float64(numSamples) * float64(width))
+	}
+	toX := func(sample int64) float64 {
+		return toWidth(sample - decoded.Start)
+	}
+
+	var spans []markerSpan
+	for _, m := range wav.Markers {
+		start, end := m.Offset, m.Offset
+		if m.IsRegion() {
+			end += m.Length
+		}
+		if start < 0 || start > decoded.End || end < decoded.Start || !m.IsRegion() && start < decoded.Start {
+			continue
+		}
+		if start < decoded.Start {
+			start = decoded.Start
+		}
+		if end > decoded.End {
+			end = decoded.End
+		}
+
+		span := markerSpan{
+			X:     toX(start),
+			Label: m.Label,
+			Class: "marker",
+			Color: "blue",
+		}
+		if span.Label == "" {
+			span.Label = m.Note
+		}
+
+		if m.IsRegion() {
+			span.Width = toWidth(end - start)
+			span.Class = "region"
+		}
+
+		spans = append(spans, span)
+	}
+
+	if overlay.Loops && wav.Sampler != nil {
+		for i, l := range wav.Sampler.Loops {
+			start, end := int64(l.Start), int64(l.End)+1
+			if start < decoded.Start {
+				start = decoded.Start
+			}
+			if end > decoded.End {
+				end = decoded.End
+			}
+			if end <= start {
+				continue
+			}
+
+			spans = append(spans, markerSpan{
+				X:     toX(start),
+				Width: math.Max(toX(end)-toX(start), 1),
+				Label: fmt.Sprintf("Loop %d (%s)", i+1, l.GetTypeName()),
+				Class: "loop",
+				Color: "green",
+			})
+		}
+	}
+
+	return spans
+}
+
+// getAsciiMarkerColumns returns, for each column of an ascii waveform, the
+// character to draw in the negative space: a dotted line for markers and a
+// shade for regions and loops, or 0 for the columns without any.
+func getAsciiMarkerColumns(wav *parser.Wav, overlay Overlay, width int) []rune {
+	const (
+		markerRune = '┊'
+		regionRune = '░'
+		loopRune   = '▒'
+	)
+
+	columns := make([]rune, width)
+	for _, span := range getMarkerSpans(wav, overlay, width) {
+		x := int(span.X)
+		if x >= width {
+			x = width - 1
+		}
+
+		if span.Width == 0 {
+			columns[x] = markerRune
+			continue
+		}
+
+		shade := regionRune
+		if span.Class == "loop" {
+			shade = loopRune
+		}
+
+		for i := x; i < x+int(span.Width) && i < width; i++ {
+			if columns[i] == 0 || shade == loopRune {
+				columns[i] = shade
+			}
+		}
+	}
+
+	return columns
+}
+
+// getAsciiMarkerLabels renders the marker labels as a line of text that fits
+// above an ascii waveform.
+func getAsciiMarkerLabels(wav *parser.Wav, overlay Overlay, width int) string {
+	var labels []label
+	for _, span := range getMarkerSpans(wav, overlay, width) {
+		if span.Label != "" {
+			labels = append(labels, label{X: span.X, Text: span.Label, Anchor: "start"})
+		}
+	}
+
+	return layoutAsciiLabels(labels, width)
+}
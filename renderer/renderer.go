@@ -2,33 +2,49 @@ package renderer
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"html/template"
 	"math"
 	"path/filepath"
+	"sort"
+	"strings"
 	"wav/parser"
 )
 
-func ToBlobSvg(wav *parser.Wav, amplitudes []int16, width int, height int, resolution int) (string, error) {
+// Overlay holds the optional annotations drawn over the waveforms; the cue
+// points and regions are always drawn.
+type Overlay struct {
+	TimeAxis TimeAxis
+	FPS      int  // frames per second for the SMPTE timecode
+	Loops    bool // whether to highlight the sampler loops
+}
+
+func ToBlobSvg(wav *parser.Wav, amplitudes []float64, bucketSize int, width int, height int, resolution int, overlay Overlay) (string, error) {
 	if resolution == 0 {
 		resolution = 5
 	}
 
 	amplitudesLen := len(amplitudes)
+	numSamples := amplitudesLen * bucketSize
 
-	if resolution > amplitudesLen {
-		resolution = amplitudesLen
+	if resolution > numSamples {
+		resolution = numSamples
 	}
 
-	chunksCount := amplitudesLen / (int(wav.SampleRate / int32(resolution)))
-
-	samplesPerChunk := amplitudesLen / chunksCount
-	if samplesPerChunk == 0 {
+	chunksCount := numSamples / (int(wav.SampleRate / int32(resolution)))
+	if chunksCount > amplitudesLen {
+		// the amplitudes were reduced further than the resolution asks for
+		chunksCount = amplitudesLen
+	}
+	if chunksCount == 0 {
 		return "", fmt.Errorf("not enough samples")
 	}
 
-	var output []int16
-	var chunks [][]int16
+	samplesPerChunk := amplitudesLen / chunksCount
+
+	var output []float64
+	var chunks [][]float64
 	for i := 0; i < amplitudesLen; i += samplesPerChunk {
 		end := i + samplesPerChunk
 		if end > amplitudesLen {
@@ -39,7 +55,7 @@ func ToBlobSvg(wav *parser.Wav, amplitudes []int16, width int, height int, resol
 	}
 
 	for _, c := range chunks {
-		var maxInChunk int16
+		var maxInChunk float64
 		for _, s := range c {
 			if s > maxInChunk {
 				maxInChunk = s
@@ -49,11 +65,11 @@ func ToBlobSvg(wav *parser.Wav, amplitudes []int16, width int, height int, resol
 		output = append(output, maxInChunk)
 	}
 
-	var ypoints []int
+	var ypoints []float64
 
 	for _, v := range output {
 		v = v / 2 // cut in half because all these points will be placed in the svg's upper half
-		y := height/2 - int(v)
+		y := float64(height)/2 - v
 		ypoints = append(ypoints, y)
 	}
 
@@ -70,7 +86,7 @@ func ToBlobSvg(wav *parser.Wav, amplitudes []int16, width int, height int, resol
 	for i, v := range ypoints {
 		points = append(points, point{
 			X: float64(i) * xstep,
-			Y: float64(v),
+			Y: v,
 		})
 	}
 
@@ -110,46 +126,71 @@ func ToBlobSvg(wav *parser.Wav, amplitudes []int16, width int, height int, resol
 	}
 
 	type svg struct {
-		Width    int
-		Height   int
-		Points   []point
-		PathData string
+		Title      string
+		Width      int
+		Height     int
+		ViewHeight int
+		Points     []point
+		PathData   string
+		Markers    []markerSpan
+		Ticks      []label
+		TickY      int
+		LabelY     int
 	}
 
 	svgStruct := svg{
-		Width:    width,
-		Height:   height,
-		Points:   points,
-		PathData: pathData.String(),
-	}
-
-	svgTemplate := `<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
-	<path d="{{ .PathData }} Z" fill="none" stroke="red" stroke-width="1"/>
+		Title:      getTitle(wav),
+		Width:      width,
+		Height:     height,
+		ViewHeight: height,
+		Points:     points,
+		PathData:   pathData.String(),
+		Markers:    getMarkerSpans(wav, overlay, width),
+		Ticks:      getTimeTicks(wav, overlay, width, width/100+1),
+		TickY:      height + svgAxisHeight/4,
+		LabelY:     height + svgAxisHeight*3/4,
+	}
+	if len(svgStruct.Ticks) > 0 {
+		svgStruct.ViewHeight += svgAxisHeight
+	}
+
+	svgTemplate := `<svg width="{{.Width}}" height="{{.ViewHeight}}" viewBox="0 0 {{.Width}} {{.ViewHeight}}" xmlns="http://www.w3.org/2000/svg">
+	{{if .Title}}<title>{{.Title}}</title>
+	{{end}}{{range .Markers}}{{if .Width}}<rect class="{{.Class}}" x="{{.X}}" y="0" width="{{.Width}}" height="{{$.Height}}" fill="{{.Color}}" fill-opacity="0.15"/>{{else}}<line class="{{.Class}}" x1="{{.X}}" y1="0" x2="{{.X}}" y2="{{$.Height}}" stroke="{{.Color}}" stroke-width="1"/>{{end}}{{if .Label}}
+	<text class="{{.Class}}-label" x="{{.X}}" y="10" dx="2" font-size="10" fill="{{.Color}}">{{.Label}}</text>{{end}}
+	{{end}}<path d="{{ .PathData }} Z" fill="none" stroke="red" stroke-width="1"/>{{range .Ticks}}
+	<line class="tick" x1="{{.X}}" y1="{{$.Height}}" x2="{{.X}}" y2="{{$.TickY}}" stroke="black" stroke-width="1"/>
+	<text class="tick-label" x="{{.X}}" y="{{$.LabelY}}" font-size="10" text-anchor="{{.Anchor}}">{{.Text}}</text>{{end}}
 </svg>`
 
 	return getStringFromSvgTemplate(svgTemplate, svgStruct)
 }
 
-func ToSingleLineSvg(wav *parser.Wav, amplitudes []int16, width int, height int, resolution int) (string, error) {
+func ToSingleLineSvg(wav *parser.Wav, amplitudes []float64, bucketSize int, width int, height int, resolution int, overlay Overlay) (string, error) {
 	if resolution == 0 {
 		resolution = 5
 	}
 
 	amplitudesLen := len(amplitudes)
+	numSamples := amplitudesLen * bucketSize
 
-	if resolution > amplitudesLen {
-		resolution = amplitudesLen
+	if resolution > numSamples {
+		resolution = numSamples
 	}
 
-	chunksCount := amplitudesLen / (int(wav.SampleRate / int32(resolution)))
-
-	samplesPerChunk := amplitudesLen / chunksCount
-	if samplesPerChunk == 0 {
+	chunksCount := numSamples / (int(wav.SampleRate / int32(resolution)))
+	if chunksCount > amplitudesLen {
+		// the amplitudes were reduced further than the resolution asks for
+		chunksCount = amplitudesLen
+	}
+	if chunksCount == 0 {
 		return "", fmt.Errorf("not enough samples")
 	}
 
-	var output []int16
-	var chunks [][]int16
+	samplesPerChunk := amplitudesLen / chunksCount
+
+	var output []float64
+	var chunks [][]float64
 	for i := 0; i < amplitudesLen; i += samplesPerChunk {
 		end := i + samplesPerChunk
 		if end > amplitudesLen {
@@ -160,7 +201,7 @@ func ToSingleLineSvg(wav *parser.Wav, amplitudes []int16, width int, height int,
 	}
 
 	for _, c := range chunks {
-		var maxInChunk int16
+		var maxInChunk float64
 		for _, s := range c {
 			if s > maxInChunk {
 				maxInChunk = s
@@ -170,15 +211,15 @@ func ToSingleLineSvg(wav *parser.Wav, amplitudes []int16, width int, height int,
 		output = append(output, maxInChunk)
 	}
 
-	var ypoints []int
+	var ypoints []float64
 
 	for index, v := range output {
 		v = v / 2
-		modifier := -1
+		modifier := -1.0
 		if index%2 == 0 {
 			modifier *= -1
 		}
-		y := height/2 + int(v)*modifier
+		y := float64(height)/2 + v*modifier
 		ypoints = append(ypoints, y)
 	}
 
@@ -195,7 +236,7 @@ func ToSingleLineSvg(wav *parser.Wav, amplitudes []int16, width int, height int,
 	for i, v := range ypoints {
 		points = append(points, point{
 			X: float64(i) * xstep,
-			Y: float64(v),
+			Y: v,
 		})
 	}
 
@@ -218,27 +259,47 @@ func ToSingleLineSvg(wav *parser.Wav, amplitudes []int16, width int, height int,
 	}
 
 	type svg struct {
-		Width    int
-		Height   int
-		Points   []point
-		PathData string
+		Title      string
+		Width      int
+		Height     int
+		ViewHeight int
+		Points     []point
+		PathData   string
+		Markers    []markerSpan
+		Ticks      []label
+		TickY      int
+		LabelY     int
 	}
 
 	svgStruct := svg{
-		Width:    width,
-		Height:   height,
-		Points:   points,
-		PathData: pathData.String(),
-	}
-
-	svgTemplate := `<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
-	<path d="{{ .PathData }}" fill="none" stroke="red" stroke-width="1"/>
+		Title:      getTitle(wav),
+		Width:      width,
+		Height:     height,
+		ViewHeight: height,
+		Points:     points,
+		PathData:   pathData.String(),
+		Markers:    getMarkerSpans(wav, overlay, width),
+		Ticks:      getTimeTicks(wav, overlay, width, width/100+1),
+		TickY:      height + svgAxisHeight/4,
+		LabelY:     height + svgAxisHeight*3/4,
+	}
+	if len(svgStruct.Ticks) > 0 {
+		svgStruct.ViewHeight += svgAxisHeight
+	}
+
+	svgTemplate := `<svg width="{{.Width}}" height="{{.ViewHeight}}" viewBox="0 0 {{.Width}} {{.ViewHeight}}" xmlns="http://www.w3.org/2000/svg">
+	{{if .Title}}<title>{{.Title}}</title>
+	{{end}}{{range .Markers}}{{if .Width}}<rect class="{{.Class}}" x="{{.X}}" y="0" width="{{.Width}}" height="{{$.Height}}" fill="{{.Color}}" fill-opacity="0.15"/>{{else}}<line class="{{.Class}}" x1="{{.X}}" y1="0" x2="{{.X}}" y2="{{$.Height}}" stroke="{{.Color}}" stroke-width="1"/>{{end}}{{if .Label}}
+	<text class="{{.Class}}-label" x="{{.X}}" y="10" dx="2" font-size="10" fill="{{.Color}}">{{.Label}}</text>{{end}}
+	{{end}}<path d="{{ .PathData }}" fill="none" stroke="red" stroke-width="1"/>{{range .Ticks}}
+	<line class="tick" x1="{{.X}}" y1="{{$.Height}}" x2="{{.X}}" y2="{{$.TickY}}" stroke="black" stroke-width="1"/>
+	<text class="tick-label" x="{{.X}}" y="{{$.LabelY}}" font-size="10" text-anchor="{{.Anchor}}">{{.Text}}</text>{{end}}
 </svg>`
 
 	return getStringFromSvgTemplate(svgTemplate, svgStruct)
 }
 
-func ToRadialSvg(wav *parser.Wav, amplitudes []int16, width int, height int, CircleRadius int, resolution int) (string, error) {
+func ToRadialSvg(wav *parser.Wav, amplitudes []float64, bucketSize int, width int, height int, CircleRadius int, resolution int, cover *parser.Picture) (string, error) {
 	const (
 		defaultResolution = 5
 	)
@@ -248,19 +309,24 @@ func ToRadialSvg(wav *parser.Wav, amplitudes []int16, width int, height int, Cir
 	}
 
 	amplitudesLen := len(amplitudes)
+	numSamples := amplitudesLen * bucketSize
 
-	if resolution > amplitudesLen {
-		resolution = amplitudesLen
+	if resolution > numSamples {
+		resolution = numSamples
 	}
 
-	chunksCount := amplitudesLen / (int(wav.SampleRate / int32(resolution)))
-
-	samplesPerChunk := amplitudesLen / chunksCount
-	if samplesPerChunk == 0 {
+	chunksCount := numSamples / (int(wav.SampleRate / int32(resolution)))
+	if chunksCount > amplitudesLen {
+		// the amplitudes were reduced further than the resolution asks for
+		chunksCount = amplitudesLen
+	}
+	if chunksCount == 0 {
 		return "", fmt.Errorf("not enough samples")
 	}
 
-	var chunks [][]int16
+	samplesPerChunk := amplitudesLen / chunksCount
+
+	var chunks [][]float64
 	for i := 0; i < amplitudesLen; i += samplesPerChunk {
 		end := i + samplesPerChunk
 		if end > amplitudesLen {
@@ -270,9 +336,9 @@ func ToRadialSvg(wav *parser.Wav, amplitudes []int16, width int, height int, Cir
 		chunks = append(chunks, amplitudes[i:end])
 	}
 
-	var output []int16
+	var output []float64
 	for _, c := range chunks {
-		var maxInChunk int16
+		var maxInChunk float64
 		for _, s := range c {
 			if s > maxInChunk {
 				maxInChunk = s
@@ -282,10 +348,10 @@ func ToRadialSvg(wav *parser.Wav, amplitudes []int16, width int, height int, Cir
 		output = append(output, maxInChunk)
 	}
 
-	var lengths []int
+	var lengths []float64
 
 	for _, v := range output {
-		lengths = append(lengths, CircleRadius+int(v))
+		lengths = append(lengths, float64(CircleRadius)+v)
 	}
 
 	type point struct {
@@ -300,8 +366,8 @@ func ToRadialSvg(wav *parser.Wav, amplitudes []int16, width int, height int, Cir
 
 	for _, l := range lengths {
 		points = append(points, point{
-			X: float64(l)*math.Cos(math.Pi*float64(angle)/180) + float64(width/2),
-			Y: float64(l)*math.Sin(math.Pi*float64(angle)/180) + float64(height/2),
+			X: l*math.Cos(math.Pi*float64(angle)/180) + float64(width/2),
+			Y: l*math.Sin(math.Pi*float64(angle)/180) + float64(height/2),
 		})
 
 		angle += angleIncrement
@@ -314,32 +380,48 @@ func ToRadialSvg(wav *parser.Wav, amplitudes []int16, width int, height int, Cir
 	}
 
 	type svg struct {
+		Title        string
 		Width        int
 		Height       int
 		CenterX      int
 		CenterY      int
 		CircleRadius int
 		Points       []point
+		Cover        template.URL
+		CoverX       int
+		CoverY       int
+		CoverSize    int
 	}
 
 	svgStruct := svg{
+		Title:        getTitle(wav),
 		Width:        width,
 		Height:       height,
 		CenterX:      width / 2,
 		CenterY:      height / 2,
 		CircleRadius: CircleRadius,
 		Points:       points,
+		CoverX:       width/2 - CircleRadius,
+		CoverY:       height/2 - CircleRadius,
+		CoverSize:    2 * CircleRadius,
+	}
+	if cover != nil && cover.IsImage() {
+		// embedded as a data URI, so that the svg stands on its own
+		svgStruct.Cover = template.URL("data:" + cover.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(cover.Data))
 	}
 
 	svgTemplate := `<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" xmlns="http://www.w3.org/2000/svg">
-	{{range .Points}}<line x1="{{$.CenterX}}" y1="{{$.CenterY}}" x2="{{.X}}" y2="{{.Y}}" stroke="red" stroke-width="1"></line>
-	{{end}}<circle cx="{{.CenterX}}" cy="{{.CenterY}}" r="{{.CircleRadius}}" fill="white"></circle>
+	{{if .Title}}<title>{{.Title}}</title>
+	{{end}}{{range .Points}}<line x1="{{$.CenterX}}" y1="{{$.CenterY}}" x2="{{.X}}" y2="{{.Y}}" stroke="red" stroke-width="1"></line>
+	{{end}}<circle cx="{{.CenterX}}" cy="{{.CenterY}}" r="{{.CircleRadius}}" fill="white"></circle>{{if .Cover}}
+	<clipPath id="cover-clip"><circle cx="{{.CenterX}}" cy="{{.CenterY}}" r="{{.CircleRadius}}"></circle></clipPath>
+	<image class="cover" href="{{.Cover}}" x="{{.CoverX}}" y="{{.CoverY}}" width="{{.CoverSize}}" height="{{.CoverSize}}" preserveAspectRatio="xMidYMid slice" clip-path="url(#cover-clip)"></image>{{end}}
 </svg>`
 
 	return getStringFromSvgTemplate(svgTemplate, svgStruct)
 }
 
-func ToAscii(amplitudes []int16, width int, height int, chars []string, border bool) (string, error) {
+func ToAscii(wav *parser.Wav, amplitudes []float64, width int, height int, chars []string, border bool, overlay Overlay) (string, error) {
 	amplitudesLen := len(amplitudes)
 
 	samplesPerChunk := amplitudesLen / width
@@ -347,8 +429,8 @@ func ToAscii(amplitudes []int16, width int, height int, chars []string, border b
 		return "", fmt.Errorf("not enough samples")
 	}
 
-	var output []int16
-	var chunks [][]int16
+	var output []float64
+	var chunks [][]float64
 	for i := 0; i < amplitudesLen; i += samplesPerChunk {
 		end := i + samplesPerChunk
 		if end > amplitudesLen {
@@ -359,7 +441,7 @@ func ToAscii(amplitudes []int16, width int, height int, chars []string, border b
 	}
 
 	for _, c := range chunks {
-		var maxInChunk int16
+		var maxInChunk float64
 		for _, s := range c {
 			if s > maxInChunk {
 				maxInChunk = s
@@ -378,6 +460,13 @@ func ToAscii(amplitudes []int16, width int, height int, chars []string, border b
 	m := height/2 + 1
 	var b bytes.Buffer
 
+	if labels := getAsciiMarkerLabels(wav, overlay, width); labels != "" {
+		b.WriteString(labels)
+		b.WriteByte('\n')
+	}
+
+	markerColumns := getAsciiMarkerColumns(wav, overlay, width)
+
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
 			penDown := y >= m-lengths[x]-1 && y < m+lengths[x]
@@ -397,11 +486,15 @@ func ToAscii(amplitudes []int16, width int, height int, chars []string, border b
 					b.WriteRune('│')
 				} else if penDown {
 					b.WriteString(chars[0])
+				} else if markerColumns[x] != 0 {
+					b.WriteRune(markerColumns[x])
 				} else {
 					b.WriteString(chars[1])
 				}
 			} else if penDown {
 				b.WriteString(chars[0])
+			} else if markerColumns[x] != 0 {
+				b.WriteRune(markerColumns[x])
 			} else {
 				b.WriteString(chars[1])
 			}
@@ -412,6 +505,11 @@ func ToAscii(amplitudes []int16, width int, height int, chars []string, border b
 		}
 	}
 
+	if axis := getAsciiTimeAxis(wav, overlay, width); axis != "" {
+		b.WriteByte('\n')
+		b.WriteString(axis)
+	}
+
 	return b.String(), nil
 }
 
@@ -420,12 +518,151 @@ func ToInfo(wav *parser.Wav, waveform string) string {
 
 	b.WriteByte('\n')
 	b.WriteString(fmt.Sprintf("File:\t\t%s\n", filepath.Base(wav.Name)))
-	b.WriteString(fmt.Sprintf("Channels:\t%d\n", wav.NumChannels))
+	b.WriteString(fmt.Sprintf("Channels:\t%d", wav.NumChannels))
+	if channels := formatChannels(wav); channels != "" {
+		b.WriteString(fmt.Sprintf(" (%s)", channels))
+	}
+	b.WriteByte('\n')
+	if ch := wav.SelectedChannel; ch > 0 {
+		b.WriteString(fmt.Sprintf("Drawn:\t\tchannel %d, %s\n", ch, wav.GetChannelLabel(ch-1)))
+	}
 	b.WriteString(fmt.Sprintf("Sample Rate:\t%d\n", wav.SampleRate))
-	b.WriteString(fmt.Sprintf("Precision:\t%d-bit\n", wav.BitsPerSample))
+	if wav.BitsPerSample > 0 {
+		b.WriteString(fmt.Sprintf("Precision:\t%d-bit\n", wav.BitsPerSample))
+	} else {
+		// lossy formats have no fixed precision
+		b.WriteString("Precision:\t-\n")
+	}
+	b.WriteString(fmt.Sprintf("Encoding:\t%s\n", wav.GetEncodingName()))
+	if wav.IsExtensible() {
+		b.WriteString(fmt.Sprintf("Valid Bits:\t%d\n", wav.ValidBitsPerSample))
+		b.WriteString(fmt.Sprintf("Channel Mask:\t0x%x\n", wav.ChannelMask))
+	}
 	b.WriteString(fmt.Sprintf("Byte Rate:\t%d\n", wav.ByteRate))
 	b.WriteString(fmt.Sprintf("Duration:\t%s\n", wav.GetFormattedDuration()))
+	if wav.Span != nil {
+		b.WriteString(fmt.Sprintf("Selection:\t%s\n", wav.GetFormattedSpan()))
+	}
 	b.WriteString(fmt.Sprintf("File Size:\t%d", wav.GetFileSize()))
+	if flac := wav.Flac; flac != nil && flac.HasMD5() {
+		b.WriteString(fmt.Sprintf("\nMD5:\t\t%x", flac.MD5))
+		if flac.MD5Checked && flac.MD5Match {
+			b.WriteString(" (ok)")
+		} else if flac.MD5Checked {
+			b.WriteString(" (mismatch)")
+		}
+	}
+	if mp3 := wav.MP3; mp3 != nil {
+		bitrate := "CBR"
+		if mp3.VBR {
+			bitrate = "VBR"
+		}
+		b.WriteString(fmt.Sprintf("\nBit Rate:\t%d kbps %s", wav.ByteRate*8/1000, bitrate))
+		if mp3.Encoder != "" {
+			b.WriteString(fmt.Sprintf("\nEncoder:\t%s, delay %d, padding %d", mp3.Encoder, mp3.EncoderDelay, mp3.Padding))
+		}
+	}
+
+	if peak := wav.PeakChunk; peak != nil {
+		for i, p := range peak.Peaks {
+			if i == 0 {
+				b.WriteString("\nPeaks:\t")
+			} else {
+				b.WriteString("\n\t")
+			}
+
+			b.WriteString(fmt.Sprintf("\t%s: %s at sample %d", wav.GetChannelLabel(i), formatPeak(p.Value), p.Position))
+			if i < len(peak.Measured) {
+				m := peak.Measured[i]
+				b.WriteString(fmt.Sprintf(", measured %s at sample %d", formatPeak(m.Value), m.Position))
+				if p.Matches(m) {
+					b.WriteString(" (ok)")
+				} else {
+					b.WriteString(" (mismatch)")
+				}
+			}
+		}
+	}
+
+	for i, p := range wav.Pictures {
+		if i == 0 {
+			b.WriteString("\nPictures:")
+		} else {
+			b.WriteString("\n\t")
+		}
+
+		b.WriteString(fmt.Sprintf("\t%s, %s, %d bytes", p.GetTypeName(), p.MIMEType, len(p.Data)))
+		if p.Description != "" {
+			b.WriteString(fmt.Sprintf(", %q", p.Description))
+		}
+	}
+
+	if inst := wav.Instrument; inst != nil {
+		b.WriteString(fmt.Sprintf("\nRoot Note:\t%s (%d), %+d cents, %+d dB", parser.GetNoteName(uint32(inst.UnshiftedNote)), inst.UnshiftedNote, inst.FineTune, inst.Gain))
+		b.WriteString(fmt.Sprintf("\nKey Range:\t%s-%s, velocity %d-%d", parser.GetNoteName(uint32(inst.LowNote)), parser.GetNoteName(uint32(inst.HighNote)), inst.LowVelocity, inst.HighVelocity))
+	} else if smpl := wav.Sampler; smpl != nil {
+		b.WriteString(fmt.Sprintf("\nRoot Note:\t%s (%d)", parser.GetNoteName(smpl.MIDIUnityNote), smpl.MIDIUnityNote))
+	}
+	if smpl := wav.Sampler; smpl != nil {
+		for i, l := range smpl.Loops {
+			if i == 0 {
+				b.WriteString("\nLoops:\t")
+			} else {
+				b.WriteString("\n\t")
+			}
+
+			playCount := "infinite"
+			if l.PlayCount > 0 {
+				playCount = fmt.Sprintf("%d times", l.PlayCount)
+			}
+			b.WriteString(fmt.Sprintf("\t%s, samples %d-%d, %s", l.GetTypeName(), l.Start, l.End, playCount))
+		}
+	}
+
+	if bext := wav.Bext; bext != nil {
+		if bext.Description != "" {
+			b.WriteString(fmt.Sprintf("\nDescription:\t%s", bext.Description))
+		}
+		if bext.Originator != "" {
+			b.WriteString(fmt.Sprintf("\nOriginator:\t%s", bext.Originator))
+		}
+		if bext.OriginatorReference != "" {
+			b.WriteString(fmt.Sprintf("\nOriginator Ref:\t%s", bext.OriginatorReference))
+		}
+		b.WriteString(fmt.Sprintf("\nOrigination:\t%s %s", bext.OriginationDate, bext.OriginationTime))
+		b.WriteString(fmt.Sprintf("\nTime Reference:\t%d = %s", bext.TimeReference, formatTime(wav, Overlay{TimeAxis: TimeAxisClock}, 0)))
+		if bext.HasLoudness() {
+			b.WriteString(fmt.Sprintf("\nLoudness:\t%.2f LUFS, range %.2f LU, true peak %.2f dBTP", bext.LoudnessValue, bext.LoudnessRange, bext.MaxTruePeakLevel))
+			b.WriteString(fmt.Sprintf("\nMax Loudness:\t%.2f LUFS momentary, %.2f LUFS short term", bext.MaxMomentaryLoudness, bext.MaxShortTermLoudness))
+		}
+	}
+
+	if ixml := wav.IXML; ixml != nil {
+		writeIXML(&b, wav, ixml)
+	}
+	if wav.AXML != "" {
+		root := wav.GetAXMLRoot()
+		if root == "" {
+			root = "unreadable"
+		}
+		b.WriteString(fmt.Sprintf("\nAXML:\t\t<%s>, %d bytes", root, len(wav.AXML)))
+	}
+
+	if len(wav.Metadata) > 0 {
+		keys := make([]string, 0, len(wav.Metadata))
+		for k := range wav.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("\nComments:")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString("\n\t")
+			}
+			b.WriteString(fmt.Sprintf("\t%s=%s", k, wav.Metadata[k]))
+		}
+	}
 
 	if len(waveform) > 0 {
 		b.WriteString("\n\n")
@@ -435,6 +672,95 @@ func ToInfo(wav *parser.Wav, waveform string) string {
 	return b.String()
 }
 
+// writeIXML writes the production metadata of the iXML chunk, as set by the
+// sound recordist.
+func writeIXML(b *bytes.Buffer, wav *parser.Wav, ixml *parser.IXML) {
+	if ixml.Project != "" {
+		b.WriteString(fmt.Sprintf("\nProject:\t%s", ixml.Project))
+	}
+	if ixml.Scene != "" {
+		b.WriteString(fmt.Sprintf("\nScene:\t\t%s", ixml.Scene))
+	}
+	if ixml.Take != "" {
+		b.WriteString(fmt.Sprintf("\nTake:\t\t%s", ixml.Take))
+		if ixml.Circled {
+			b.WriteString(" (circled)")
+		}
+	}
+	if ixml.Tape != "" {
+		b.WriteString(fmt.Sprintf("\nTape:\t\t%s", ixml.Tape))
+	}
+	if ixml.Note != "" {
+		b.WriteString(fmt.Sprintf("\nNote:\t\t%s", ixml.Note))
+	}
+
+	if ixml.TimecodeRate != "" {
+		b.WriteString(fmt.Sprintf("\nTimecode:\t%s %s", ixml.TimecodeRate, ixml.TimecodeFlag))
+
+		if start := ixml.GetStartTimecode(int(wav.SampleRate)); start != "" {
+			b.WriteString(fmt.Sprintf(", starting at %s", start))
+		}
+	}
+
+	for i, t := range ixml.Tracks {
+		if i == 0 {
+			b.WriteString("\nTracks:\t")
+		} else {
+			b.WriteString("\n\t")
+		}
+
+		b.WriteString(fmt.Sprintf("\t%d: %s", t.InterleaveIndex, t.Name))
+		if t.Function != "" {
+			b.WriteString(fmt.Sprintf(" (%s)", t.Function))
+		}
+	}
+}
+
+// getTitle returns the title of the svg: the one of the tags, followed by the
+// channel that was drawn, if a single one was.
+func getTitle(wav *parser.Wav) string {
+	title := wav.Metadata["title"]
+	if ch := wav.SelectedChannel; ch > 0 {
+		label := wav.GetChannelLabel(ch - 1)
+		if title == "" {
+			return label
+		}
+		return fmt.Sprintf("%s (%s)", title, label)
+	}
+
+	return title
+}
+
+// formatChannels lists the channels by their speaker position and their
+// iXML track name, e.g. "FL Boom, FR Lav", with a dash for the ones that have
+// neither, or returns "" if none of them has one.
+func formatChannels(wav *parser.Wav) string {
+	layout := wav.GetChannelLayout()
+	named := false
+	labels := make([]string, len(layout))
+	for ch, position := range layout {
+		labels[ch] = "-"
+		if position != "" || wav.GetChannelName(ch) != "" {
+			labels[ch] = wav.GetChannelLabel(ch)
+			named = true
+		}
+	}
+	if !named {
+		return ""
+	}
+
+	return strings.Join(labels, ", ")
+}
+
+// formatPeak shows a normalized peak value along with its level in dBFS.
+func formatPeak(value float32) string {
+	if value <= 0 {
+		return "0 (-inf dBFS)"
+	}
+
+	return fmt.Sprintf("%.4f (%.2f dBFS)", value, 20*math.Log10(float64(value)))
+}
+
 func getStringFromSvgTemplate(svgTemplate string, svgStruct interface{}) (string, error) {
 	var tpl bytes.Buffer
 	tmpl, err := template.New("svg").Parse(svgTemplate)
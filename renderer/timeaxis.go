@@ -0,0 +1,159 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"wav/parser"
+)
+
+// TimeAxis selects how the time positions under a waveform are labeled.
+type TimeAxis string
+
+const (
+	TimeAxisNone    TimeAxis = ""
+	TimeAxisElapsed TimeAxis = "elapsed" // time since the start of the file, even for a span of it
+	TimeAxisClock   TimeAxis = "clock"   // time of day, from the bext time reference
+	TimeAxisSMPTE   TimeAxis = "smpte"   // SMPTE timecode, from the bext time reference
+)
+
+const (
+	defaultFPS = 25
+
+	// height of the band added under the svg waveforms for the time axis
+	svgAxisHeight = 20
+)
+
+func ParseTimeAxis(s string) (TimeAxis, error) {
+	switch axis := TimeAxis(strings.ToLower(s)); axis {
+	case TimeAxisNone, TimeAxisElapsed, TimeAxisClock, TimeAxisSMPTE:
+		return axis, nil
+	default:
+		return TimeAxisNone, fmt.Errorf("unknown time axis %q", s)
+	}
+}
+
+// label is a piece of text placed at a horizontal position of a waveform.
+type label struct {
+	X      float64
+	Text   string
+	Anchor string // svg text-anchor: start, middle or end
+}
+
+// getTimeTicks returns count evenly spaced labels along a waveform that is
+// width units wide.
+func getTimeTicks(wav *parser.Wav, overlay Overlay, width int, count int) []label {
+	if overlay.TimeAxis == TimeAxisNone || count < 2 {
+		return nil
+	}
+
+	span := wav.GetSpan()
+	numSamples := span.Len()
+
+	var ticks []label
+	for i := 0; i < count; i++ {
+		fraction := float64(i) / float64(count-1)
+
+		anchor := "middle"
+		if i == 0 {
+			anchor = "start"
+		} else if i == count-1 {
+			anchor = "end"
+		}
+
+		ticks = append(ticks, label{
+			X:      math.Round(fraction * float64(width)),
+			Text:   formatTime(wav, overlay, span.Start+int64(math.Round(fraction*float64(numSamples)))),
+			Anchor: anchor,
+		})
+	}
+
+	return ticks
+}
+
+// formatTime labels the position of a sample according to the time axis.
+func formatTime(wav *parser.Wav, overlay Overlay, sample int64) string {
+	if wav.SampleRate <= 0 {
+		return ""
+	}
+
+	if overlay.TimeAxis == TimeAxisClock || overlay.TimeAxis == TimeAxisSMPTE {
+		if wav.Bext != nil {
+			sample += int64(wav.Bext.TimeReference)
+		}
+	}
+
+	return formatSeconds(float64(sample)/float64(wav.SampleRate), overlay)
+}
+
+// formatSeconds labels a time, in seconds, according to the time axis.
+func formatSeconds(seconds float64, overlay Overlay) string {
+	if overlay.TimeAxis == TimeAxisClock || overlay.TimeAxis == TimeAxisSMPTE {
+		seconds = math.Mod(seconds, 24*60*60)
+	}
+
+	d := int(seconds)
+	hours := d / 3600
+	minutes := d % 3600 / 60
+	secs := d % 60
+
+	if overlay.TimeAxis == TimeAxisSMPTE {
+		fps := overlay.FPS
+		if fps <= 0 {
+			fps = defaultFPS
+		}
+		frames := int((seconds - float64(d)) * float64(fps))
+
+		return fmt.Sprintf("%02d:%02d:%02d:%02d", hours, minutes, secs, frames)
+	}
+
+	milliseconds := int((seconds - float64(d)) * 1000)
+
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, secs, milliseconds)
+}
+
+// getAsciiTimeAxis renders the time labels as a line of text that fits under
+// an ascii waveform.
+func getAsciiTimeAxis(wav *parser.Wav, overlay Overlay, width int) string {
+	const labelSpacing = 20
+
+	return layoutAsciiLabels(getTimeTicks(wav, overlay, width-1, width/labelSpacing+1), width)
+}
+
+// layoutAsciiLabels places the labels on a line of text that is width
+// characters wide, dropping the ones that would overlap.
+func layoutAsciiLabels(labels []label, width int) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	line := []rune(strings.Repeat(" ", width))
+	free := 0 // first column that can still be written to
+
+	for _, l := range labels {
+		text := []rune(l.Text)
+		start := int(l.X)
+		switch l.Anchor {
+		case "middle":
+			start -= len(text) / 2
+		case "end":
+			start -= len(text) - 1
+		}
+
+		if start < free {
+			continue
+		}
+		if start+len(text) > width {
+			// shorten the labels that don't fit at the end of the line
+			if start >= width {
+				continue
+			}
+			text = text[:width-start]
+		}
+
+		copy(line[start:], text)
+		free = start + len(text) + 1
+	}
+
+	return strings.TrimRight(string(line), " ")
+}
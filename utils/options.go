@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+	"time"
 )
 
 type Options struct {
@@ -11,10 +12,21 @@ type Options struct {
 	Height       *int
 	Padding      *int
 	CircleRadius *int
+	Cover        *bool
 	Chars        *string
 	Border       *bool
 	Resolution   *int
 	Format       *int
+	TimeAxis     *string
+	FPS          *int
+	Loops        *bool
+	PeaksOnly    *bool
+	Raw          *string
+	Info         *bool
+	Lenient      *bool
+	Start        *time.Duration
+	End          *time.Duration
+	Channel      *string
 }
 
 func (o *Options) GetChars() []string {
@@ -36,7 +48,7 @@ func (o *Options) GetChars() []string {
 func (o *Options) Usage(flagSet *flag.FlagSet) func() {
 	return func() {
 		fmt.Printf("Usage:\n")
-		order := []string{"format", "resolution", "width", "height", "padding", "circle-radius", "chars", "border"}
+		order := []string{"format", "resolution", "width", "height", "padding", "circle-radius", "cover", "chars", "border", "time-axis", "fps", "loops", "peaks", "raw", "info", "lenient", "start", "end", "channel"}
 		for _, name := range order {
 			f := flagSet.Lookup(name)
 			fmt.Printf("  -%s\n", f.Name)
@@ -1,35 +1,37 @@
 package utils
 
-func ScaleBetween(numbers []int16, scaledMin, scaledMax int16) []int16 {
-	// first make all numbers positive
-	for i, v := range numbers {
-		if v < 0 {
-			numbers[i] = -v
-		}
-	}
-
-	var inputMin, inputMax int32
-
-	var numbersI32 []int32
+import "math"
 
+// ScaleBetween maps the magnitudes of the samples onto the [scaledMin, scaledMax]
+// range, keeping the fractional part so that no precision is lost before the
+// samples are drawn.
+func ScaleBetween(numbers []float32, scaledMin, scaledMax float64) []float64 {
+	var inputMax float64
 	for _, v := range numbers {
-		numbersI32 = append(numbersI32, int32(v))
+		inputMax = math.Max(inputMax, math.Abs(float64(v)))
 	}
 
-	for _, v := range numbersI32 {
-		if v < inputMin {
-			inputMin = v
-		}
-		if v > inputMax {
-			inputMax = v
+	return ScaleToPeak(numbers, inputMax, scaledMin, scaledMax)
+}
+
+// ScaleToPeak is like ScaleBetween, with the largest magnitude already known,
+// e.g. from the PEAK chunk, rather than looked for; the magnitudes above it
+// are clamped to scaledMax.
+func ScaleToPeak(numbers []float32, peak, scaledMin, scaledMax float64) []float64 {
+	scaledSamples := make([]float64, len(numbers))
+
+	if peak <= 0 {
+		// silence; avoid dividing by zero
+		for i := range scaledSamples {
+			scaledSamples[i] = scaledMin
 		}
-	}
 
-	var scaledSamples []int16
+		return scaledSamples
+	}
 
-	for _, v := range numbersI32 {
-		scaledValue := (int32(scaledMax)-int32(scaledMin))*(v-inputMin)/(inputMax-inputMin) + int32(scaledMin)
-		scaledSamples = append(scaledSamples, int16(scaledValue))
+	for i, v := range numbers {
+		magnitude := math.Min(math.Abs(float64(v)), peak)
+		scaledSamples[i] = (scaledMax-scaledMin)*magnitude/peak + scaledMin
 	}
 
 	return scaledSamples